@@ -0,0 +1,197 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// sessionState is what the client knows about one server-side session,
+// keyed by its CST token. The active account is state shared by every
+// caller of the session, so switch-then-act sequences hold its lock.
+type sessionState struct {
+	lock chan struct{}
+
+	mu        sync.Mutex
+	accountId string
+
+	// trailingStops records per account whether trailing stops are enabled,
+	// as reported on login and on account switches
+	trailingStops map[string]bool
+}
+
+func (c *client) sessionState(cst string) *sessionState {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+
+	state, ok := c.sessions[cst]
+	if !ok {
+		state = &sessionState{
+			lock:          make(chan struct{}, 1),
+			trailingStops: make(map[string]bool),
+		}
+		c.sessions[cst] = state
+	}
+
+	return state
+}
+
+// lockSession serializes account-scoped operations on one session, so that
+// no other caller can switch accounts between our switch and our request.
+func (c *client) lockSession(ctx context.Context, cst string) (func(), error) {
+	state := c.sessionState(cst)
+
+	select {
+	case state.lock <- struct{}{}:
+		return func() { <-state.lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *client) activeAccount(cst string) string {
+	state := c.sessionState(cst)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.accountId
+}
+
+func (c *client) setActiveAccount(cst, accountId string) {
+	state := c.sessionState(cst)
+
+	state.mu.Lock()
+	state.accountId = accountId
+	state.mu.Unlock()
+}
+
+func (c *client) setTrailingStopsEnabled(cst, accountId string, enabled bool) {
+	state := c.sessionState(cst)
+
+	state.mu.Lock()
+	state.trailingStops[accountId] = enabled
+	state.mu.Unlock()
+}
+
+// checkTrailingStops returns an error when the account or the instrument
+// does not allow trailing stops. An account the client has not seen
+// switched to or logged into is left for the server to judge.
+func (c *client) checkTrailingStops(ctx context.Context, demo bool, accountId, epic, cst, securityToken string) error {
+	if err := c.trailingStopsAllowed(cst, accountId); err != nil {
+		return err
+	}
+
+	details, err := c.getMarketDetails(ctx, demo, epic, cst, securityToken)
+	if err != nil {
+		return err
+	}
+
+	return trailingStopsAvailable(epic, details)
+}
+
+func (c *client) trailingStopsAllowed(cst, accountId string) error {
+	state := c.sessionState(cst)
+
+	state.mu.Lock()
+	enabled, known := state.trailingStops[accountId]
+	state.mu.Unlock()
+
+	if known && !enabled {
+		return ErrTrailingStopsDisabled
+	}
+
+	return nil
+}
+
+func trailingStopsAvailable(epic string, details *models.CapitalMarketDetailsResponse) error {
+	if details.DealingRules.TrailingStopsPreference != models.TrailingStopsAvailable {
+		return fmt.Errorf("%w: %s", ErrTrailingStopNotAvailable, epic)
+	}
+
+	return nil
+}
+
+// aliasSession makes newCST share the state of cst, for when an account
+// switch hands out new tokens for the same server-side session.
+func (c *client) aliasSession(cst, newCST string) {
+	if newCST == "" || newCST == cst {
+		return
+	}
+
+	state := c.sessionState(cst)
+
+	c.sessionsMu.Lock()
+	c.sessions[newCST] = state
+	c.sessionsMu.Unlock()
+}
+
+// unaliasSession drops cst once its tokens were replaced, leaving the state
+// to the CSTs that still share it.
+func (c *client) unaliasSession(cst string) {
+	c.sessionsMu.Lock()
+	delete(c.sessions, cst)
+	c.sessionsMu.Unlock()
+}
+
+// forgetSession drops the state of cst along with all its aliases.
+func (c *client) forgetSession(cst string) {
+	c.sessionsMu.Lock()
+	defer c.sessionsMu.Unlock()
+
+	state, ok := c.sessions[cst]
+	if !ok {
+		return
+	}
+
+	for key, s := range c.sessions {
+		if s == state {
+			delete(c.sessions, key)
+		}
+	}
+}
+
+// ensureAccount makes accountId the active account of the session and
+// returns the tokens to use for it. The active account is cached per session,
+// so the switch only costs a request when the account actually changes.
+// Callers must hold the session lock until they are done with the account.
+func (c *client) ensureAccount(ctx context.Context, demo bool, accountId, cst, securityToken string) (string, string, error) {
+	active := c.activeAccount(cst)
+	if active == "" {
+		currentAccount, err := c.GetCurrentAccount(ctx, demo, cst, securityToken)
+		if err != nil {
+			return "", "", fmt.Errorf("error getting current account: %w", err)
+		}
+		active = currentAccount.AccountId
+		c.setActiveAccount(cst, active)
+	}
+
+	if active == accountId {
+		return cst, securityToken, nil
+	}
+
+	_, sessionTokens, err := c.switchAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		if apiErr, ok := AsAPIError(err); ok && apiErr.ErrorCode == "error.not-different.accountId" {
+			c.setActiveAccount(cst, accountId)
+			return cst, securityToken, nil
+		}
+		return "", "", fmt.Errorf("error switching account: %w", err)
+	}
+
+	return sessionTokens.CST, sessionTokens.SecurityToken, nil
+}
+
+// isAccountMismatch reports whether the server rejected a request because
+// of the account it was made on, meaning the cached active account is stale.
+func isAccountMismatch(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+
+	code := strings.ToLower(apiErr.ErrorCode)
+	return strings.Contains(code, "accountid") && code != "error.not-different.accountid"
+}
@@ -0,0 +1,67 @@
+package capital
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// Concurrent orders for two accounts on one session, mixed with unlocked
+// reads of the current account, must each land on the account they name.
+func TestOpenPositionConcurrentAccounts(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	c := broker.client()
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				if _, err := c.GetCurrentAccount(ctx, false, "cst", "token"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	var orders sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		account := "A"
+		if i%2 == 1 {
+			account = "B"
+		}
+
+		orders.Add(1)
+		go func() {
+			defer orders.Done()
+			order := OrderRequest{Epic: "EPIC-" + account, Direction: Buy, Size: 1}
+			if _, err := c.OpenPosition(ctx, false, account, order, "cst", "token"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	orders.Wait()
+	close(done)
+	readers.Wait()
+
+	positions := broker.opened()
+	if len(positions) != 50 {
+		t.Fatalf("opened %d positions, want 50", len(positions))
+	}
+
+	for _, p := range positions {
+		if p.epic != "EPIC-"+p.account {
+			t.Errorf("%s for %s was opened on account %s", p.dealID, p.epic, p.account)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package capital
+
+import (
+	"capital/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker is a local stand-in for the parts of the Capital.com API that
+// trading goes through. It keeps one session with an active account and
+// records on which account each position was opened.
+type fakeBroker struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	active    string
+	positions []fakePosition
+	posts     int
+
+	// failPosts makes that many position posts fail with a server error
+	// after the position was opened, so their outcome looks unknown
+	failPosts int
+}
+
+type fakePosition struct {
+	dealID    string
+	epic      string
+	direction string
+	size      float64
+	account   string
+	created   time.Time
+}
+
+func newFakeBroker(t *testing.T, active string) *fakeBroker {
+	b := &fakeBroker{active: active}
+	b.Server = httptest.NewServer(http.HandlerFunc(b.serve))
+	t.Cleanup(b.Close)
+
+	return b
+}
+
+// client returns a client talking to the broker, without rate limits so
+// tests do not wait on them.
+func (b *fakeBroker) client(opts ...Option) Client {
+	opts = append([]Option{WithRateLimits(RateLimits{})}, opts...)
+	return New(b.URL, b.URL, opts...)
+}
+
+func (b *fakeBroker) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/session":
+		b.mu.Lock()
+		active := b.active
+		b.mu.Unlock()
+
+		// Answer slowly, so that switches can overtake the answer
+		time.Sleep(5 * time.Millisecond)
+		json.NewEncoder(w).Encode(models.CurrentAccount{AccountId: active})
+
+	case r.Method == "PUT" && r.URL.Path == "/session":
+		var payload struct {
+			AccountID string `json:"accountId"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		b.mu.Lock()
+		b.active = payload.AccountID
+		b.mu.Unlock()
+
+		json.NewEncoder(w).Encode(models.SwitchAccountResponse{TrailingStopsEnabled: true})
+
+	case r.Method == "POST" && r.URL.Path == "/positions":
+		var payload struct {
+			Epic      string  `json:"epic"`
+			Direction string  `json:"direction"`
+			Size      float64 `json:"size"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		b.mu.Lock()
+		b.posts++
+		dealID := fmt.Sprintf("deal-%d", b.posts)
+		b.positions = append(b.positions, fakePosition{
+			dealID:    dealID,
+			epic:      payload.Epic,
+			direction: payload.Direction,
+			size:      payload.Size,
+			account:   b.active,
+			created:   time.Now().UTC(),
+		})
+		fail := b.failPosts > 0
+		if fail {
+			b.failPosts--
+		}
+		b.mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.CapitalDealReference{DealReference: "ref-" + dealID})
+
+	case r.Method == "GET" && r.URL.Path == "/positions":
+		var response models.PositionsResponse
+		for _, p := range b.opened() {
+			var obj models.PositionObj
+			obj.Market.Epic = p.epic
+			obj.Position.DealId = p.dealID
+			obj.Position.Direction = p.direction
+			obj.Position.Size = p.size
+			obj.Position.CreatedDateUTC = p.created.Format(models.DateTimeLayout)
+			response.Positions = append(response.Positions, obj)
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/markets/"):
+		json.NewEncoder(w).Encode(models.CapitalMarketDetailsResponse{
+			Instrument: models.Instrument{Epic: strings.TrimPrefix(r.URL.Path, "/markets/")},
+			DealingRules: models.DealingRules{
+				MinDealSize: models.DealSize{Value: 0.1},
+				MaxDealSize: models.DealSize{Value: 100},
+			},
+			Snapshot: models.MarketSnapshot{MarketStatus: models.MarketStatusTradeable, Bid: 99, Offer: 100},
+		})
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/confirms/"):
+		dealID := strings.TrimPrefix(r.URL.Path, "/confirms/ref-")
+		json.NewEncoder(w).Encode(models.CapitalDealConfirmation{
+			DealStatus:    models.DealStatusAccepted,
+			DealID:        dealID,
+			AffectedDeals: []models.AffectedDeal{{DealID: dealID, Status: models.AffectedDealOpened}},
+		})
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errorCode":"error.not-found"}`))
+	}
+}
+
+func (b *fakeBroker) postCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.posts
+}
+
+func (b *fakeBroker) opened() []fakePosition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]fakePosition(nil), b.positions...)
+}
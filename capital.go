@@ -2,31 +2,108 @@ package capital
 
 import (
 	"capital/models"
+	"context"
+	"io"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 )
 
 type Client interface {
-	CreateSession(demo bool, apiKey, identifier, password string) (*models.CreateSessionResponse, *models.SessionTokens, error)
-	OpenPosition(demo bool, accountId, direction, epic string, size float64, stopLevel, profitLevel *float64, guaranteedStop bool, cst, securityToken string) (string, error)
-	ClosePosition(demo bool, accountId, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error)
-	ConfirmDeal(demo bool, accountId, dealReference string, cst, securityToken string) (*models.CapitalDealConfirmation, error)
-	GetPositions(demo bool, accountId, cst, securityToken string) (*models.PositionsResponse, error)
-	GetMarketDetails(demo bool, accountId, epic string, cst, securityToken string) (*models.CapitalMarketDetailsResponse, error)
-	GetAccounts(demo bool, cst, securityToken string) ([]models.CapitalAccount, error)
-	SwitchActiveAccount(demo bool, accountId string, cst, securityToken string) (*models.SwitchAccountResponse, *models.SessionTokens, error)
-	GetCurrentAccount(demo bool, cst, securityToken string) (*models.CurrentAccount, error)
+	CreateSession(ctx context.Context, demo bool, apiKey, identifier, password string) (*models.CreateSessionResponse, *models.SessionTokens, error)
+	OpenPosition(ctx context.Context, demo bool, accountId string, order OrderRequest, cst, securityToken string) (string, error)
+	PreTradeCheck(ctx context.Context, demo bool, accountId string, order OrderRequest, cst, securityToken string) (*PreTradeReport, error)
+	ClosePosition(ctx context.Context, demo bool, accountId, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error)
+	CloseAll(ctx context.Context, demo bool, accountId string, filter CloseFilter, cst, securityToken string) (*CloseAllReport, error)
+	ReducePosition(ctx context.Context, demo bool, accountId, dealID string, reduction Reduction, cst, securityToken string) (*PartialCloseResult, error)
+	UpdatePosition(ctx context.Context, demo bool, accountId, dealID string, update models.UpdatePositionRequest, cst, securityToken string) (*models.PositionObj, error)
+	ConfirmDeal(ctx context.Context, demo bool, accountId, dealReference string, cst, securityToken string) (*models.CapitalDealConfirmation, error)
+	GetPositions(ctx context.Context, demo bool, accountId, cst, securityToken string) (*models.PositionsResponse, error)
+	GetMarketDetails(ctx context.Context, demo bool, accountId, epic string, cst, securityToken string) (*models.CapitalMarketDetailsResponse, error)
+	CreateWorkingOrder(ctx context.Context, demo bool, accountId string, order models.WorkingOrderRequest, cst, securityToken string) (string, error)
+	GetWorkingOrders(ctx context.Context, demo bool, accountId, cst, securityToken string) (*models.WorkingOrdersResponse, error)
+	UpdateWorkingOrder(ctx context.Context, demo bool, accountId, dealID string, update models.UpdateWorkingOrderRequest, cst, securityToken string) (*models.CapitalDealConfirmation, error)
+	DeleteWorkingOrder(ctx context.Context, demo bool, accountId, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error)
+	GetActivityHistory(ctx context.Context, demo bool, accountId string, from, to time.Time, cst, securityToken string) ([]models.Activity, error)
+	SearchMarkets(ctx context.Context, demo bool, term string, cst, securityToken string) ([]models.Market, error)
+	GetMarketSnapshots(ctx context.Context, demo bool, epics []string, cst, securityToken string) ([]models.CapitalMarket, error)
+	GetMarketNavigation(ctx context.Context, demo bool, nodeID string, cst, securityToken string) (*models.MarketNavigationResponse, error)
+	BuildCatalog(ctx context.Context, demo bool, cst, securityToken string) (*Catalog, error)
+	GetTradingHours(ctx context.Context, demo bool, epic string, cst, securityToken string) (*TradingHours, error)
+	GetPrices(ctx context.Context, demo bool, epic string, query PriceQuery, cst, securityToken string) ([]models.PriceBar, error)
+	GetAccounts(ctx context.Context, demo bool, cst, securityToken string) ([]models.CapitalAccount, error)
+	GetAccountPreferences(ctx context.Context, demo bool, accountId, cst, securityToken string) (*models.AccountPreferences, error)
+	UpdateAccountPreferences(ctx context.Context, demo bool, accountId string, update models.UpdatePreferencesRequest, cst, securityToken string) (*models.AccountPreferences, error)
+	SwitchActiveAccount(ctx context.Context, demo bool, accountId string, cst, securityToken string) (*models.SwitchAccountResponse, *models.SessionTokens, error)
+	GetCurrentAccount(ctx context.Context, demo bool, cst, securityToken string) (*models.CurrentAccount, error)
+	GetSessionInfo(ctx context.Context, demo bool, cst, securityToken string) (*models.SessionInfo, error)
+	Ping(ctx context.Context, demo bool, cst, securityToken string) error
+	Logout(ctx context.Context, demo bool, cst, securityToken string) error
 }
 
+const (
+	DefaultBaseURL     = "https://api-capital.backend-capital.com/api/v1"
+	DefaultDemoBaseURL = "https://demo-api-capital.backend-capital.com/api/v1"
+	DefaultTimeout     = 30 * time.Second
+)
+
 type client struct {
-	httpClient  *http.Client
-	baseURL     string
-	demoBaseURL string
+	httpClient    *http.Client
+	baseURL       string
+	demoBaseURL   string
+	limiters      *rateLimiters
+	retryPolicy   RetryPolicy
+	confirmPolicy ConfirmPolicy
+	timeout       time.Duration
+	userAgent     string
+	logger        *slog.Logger
+	apiKey        string
+
+	encryptPassword bool
+	preTradeChecks  bool
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*sessionState
+
+	orderKeysMu       sync.Mutex
+	orderKeys         map[orderKeyID]*orderKeyEntry
+	orderKeyRetention time.Duration
 }
 
-func New(baseUrl, demoBaseUrl string) Client {
-	return &client{
-		httpClient:  &http.Client{},
-		baseURL:     baseUrl,
-		demoBaseURL: demoBaseUrl,
+// New creates a client for the given live and demo API base URLs. An empty
+// URL falls back to the public Capital.com host for that environment.
+func New(baseUrl, demoBaseUrl string, opts ...Option) Client {
+	if baseUrl == "" {
+		baseUrl = DefaultBaseURL
+	}
+	if demoBaseUrl == "" {
+		demoBaseUrl = DefaultDemoBaseURL
+	}
+
+	c := &client{
+		httpClient:    &http.Client{Timeout: DefaultTimeout},
+		baseURL:       baseUrl,
+		demoBaseURL:   demoBaseUrl,
+		limiters:      newRateLimiters(DefaultRateLimits()),
+		retryPolicy:   DefaultRetryPolicy(),
+		confirmPolicy: DefaultConfirmPolicy(),
+		logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		sessions:      make(map[string]*sessionState),
+
+		orderKeys:         make(map[orderKeyID]*orderKeyEntry),
+		orderKeyRetention: DefaultOrderKeyRetention,
+	}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	return c
+}
+
+// NewClient creates a client for the public Capital.com hosts, configured
+// entirely through options.
+func NewClient(opts ...Option) Client {
+	return New("", "", opts...)
 }
@@ -0,0 +1,116 @@
+package capital
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// PathSeparator joins node names in CSV exports and PathString.
+const PathSeparator = " > "
+
+type CatalogEntry struct {
+	Epic           string   `json:"epic"`
+	InstrumentName string   `json:"instrumentName"`
+	InstrumentType string   `json:"instrumentType"`
+	Path           []string `json:"path"`
+}
+
+func (e CatalogEntry) PathString() string {
+	return strings.Join(e.Path, PathSeparator)
+}
+
+// Catalog lists the instruments found in the market navigation tree, sorted
+// by epic and path.
+type Catalog struct {
+	Entries []CatalogEntry `json:"entries"`
+}
+
+func (c *Catalog) sort() {
+	sort.SliceStable(c.Entries, func(i, j int) bool {
+		a, b := c.Entries[i], c.Entries[j]
+		if a.Epic != b.Epic {
+			return a.Epic < b.Epic
+		}
+		return a.PathString() < b.PathString()
+	})
+}
+
+// Epics returns every distinct epic in the catalog with its first entry.
+func (c *Catalog) Epics() map[string]CatalogEntry {
+	epics := make(map[string]CatalogEntry, len(c.Entries))
+	for _, entry := range c.Entries {
+		if _, ok := epics[entry.Epic]; !ok {
+			epics[entry.Epic] = entry
+		}
+	}
+
+	return epics
+}
+
+func (c *Catalog) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c)
+}
+
+func ReadCatalogJSON(r io.Reader) (*Catalog, error) {
+	var catalog Catalog
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("error parsing catalog: %w", err)
+	}
+	catalog.sort()
+
+	return &catalog, nil
+}
+
+// WriteCSV writes one row per entry with the columns epic, instrumentName,
+// instrumentType and path.
+func (c *Catalog) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"epic", "instrumentName", "instrumentType", "path"}); err != nil {
+		return err
+	}
+
+	for _, entry := range c.Entries {
+		if err := writer.Write([]string{entry.Epic, entry.InstrumentName, entry.InstrumentType, entry.PathString()}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type CatalogDiff struct {
+	Added   []CatalogEntry
+	Removed []CatalogEntry
+}
+
+func (d CatalogDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DiffCatalogs compares two catalogs by epic, reporting the instruments
+// newly listed in newer and those no longer present in it.
+func DiffCatalogs(older, newer *Catalog) CatalogDiff {
+	before, after := older.Epics(), newer.Epics()
+
+	var diff CatalogDiff
+	for _, entry := range newer.Entries {
+		if _, ok := before[entry.Epic]; !ok && after[entry.Epic].PathString() == entry.PathString() {
+			diff.Added = append(diff.Added, entry)
+		}
+	}
+
+	for _, entry := range older.Entries {
+		if _, ok := after[entry.Epic]; !ok && before[entry.Epic].PathString() == entry.PathString() {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+
+	return diff
+}
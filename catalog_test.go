@@ -0,0 +1,128 @@
+package capital
+
+import (
+	"bytes"
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// navigationServer serves a market navigation tree keyed by node ID, with
+// the root under the empty ID.
+func navigationServer(t *testing.T, tree map[string]models.MarketNavigationResponse) Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node, ok := tree[strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/marketnavigation"), "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"error.not-found.nodeId"}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(node)
+	}))
+	t.Cleanup(server.Close)
+
+	return New(server.URL, server.URL, WithRateLimits(RateLimits{}))
+}
+
+func TestBuildCatalog(t *testing.T) {
+	c := navigationServer(t, map[string]models.MarketNavigationResponse{
+		"": {Nodes: []models.MarketNavigationNode{{ID: "fx", Name: "Forex"}, {ID: "pop", Name: "Popular"}}},
+		"fx": {
+			Nodes:   []models.MarketNavigationNode{{ID: "majors", Name: "Majors"}},
+			Markets: []models.Market{{Epic: "EURGBP", InstrumentName: "EUR/GBP", InstrumentType: "CURRENCIES"}},
+		},
+		"majors": {
+			// Leads back up the tree, which must not loop
+			Nodes:   []models.MarketNavigationNode{{ID: "fx", Name: "Forex"}},
+			Markets: []models.Market{{Epic: "EURUSD", InstrumentName: "EUR/USD", InstrumentType: "CURRENCIES"}},
+		},
+		"pop": {
+			Markets: []models.Market{{Epic: "EURUSD", InstrumentName: "EUR/USD", InstrumentType: "CURRENCIES"}},
+		},
+	})
+
+	catalog, err := c.BuildCatalog(context.Background(), false, "cst", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []CatalogEntry{
+		{Epic: "EURGBP", InstrumentName: "EUR/GBP", InstrumentType: "CURRENCIES", Path: []string{"Forex"}},
+		{Epic: "EURUSD", InstrumentName: "EUR/USD", InstrumentType: "CURRENCIES", Path: []string{"Forex", "Majors"}},
+		{Epic: "EURUSD", InstrumentName: "EUR/USD", InstrumentType: "CURRENCIES", Path: []string{"Popular"}},
+	}
+	if !reflect.DeepEqual(catalog.Entries, want) {
+		t.Fatalf("got entries %+v, want %+v", catalog.Entries, want)
+	}
+}
+
+func TestBuildCatalogTruncated(t *testing.T) {
+	full := models.MarketNavigationResponse{}
+	for i := 0; i < maxNavigationMarkets; i++ {
+		full.Markets = append(full.Markets, models.Market{Epic: fmt.Sprintf("EPIC%d", i)})
+	}
+
+	c := navigationServer(t, map[string]models.MarketNavigationResponse{
+		"":       {Nodes: []models.MarketNavigationNode{{ID: "shares", Name: "Shares"}}},
+		"shares": full,
+	})
+
+	if _, err := c.BuildCatalog(context.Background(), false, "cst", "token"); !errors.Is(err, ErrCatalogTruncated) {
+		t.Fatalf("got error %v, want ErrCatalogTruncated", err)
+	}
+}
+
+func TestDiffCatalogs(t *testing.T) {
+	older := &Catalog{Entries: []CatalogEntry{
+		{Epic: "EURGBP", Path: []string{"Forex"}},
+		{Epic: "EURUSD", Path: []string{"Forex", "Majors"}},
+		{Epic: "EURUSD", Path: []string{"Popular"}},
+	}}
+	newer := &Catalog{Entries: []CatalogEntry{
+		{Epic: "EURUSD", Path: []string{"Forex", "Majors"}},
+		{Epic: "GBPUSD", Path: []string{"Forex", "Majors"}},
+		{Epic: "GBPUSD", Path: []string{"Popular"}},
+	}}
+
+	diff := DiffCatalogs(older, newer)
+
+	// Each instrument is reported once, under its first path
+	if want := []CatalogEntry{{Epic: "GBPUSD", Path: []string{"Forex", "Majors"}}}; !reflect.DeepEqual(diff.Added, want) {
+		t.Errorf("got added %+v, want %+v", diff.Added, want)
+	}
+
+	if want := []CatalogEntry{{Epic: "EURGBP", Path: []string{"Forex"}}}; !reflect.DeepEqual(diff.Removed, want) {
+		t.Errorf("got removed %+v, want %+v", diff.Removed, want)
+	}
+
+	if !DiffCatalogs(newer, newer).Empty() {
+		t.Error("a catalog differs from itself")
+	}
+}
+
+func TestCatalogWriteCSV(t *testing.T) {
+	catalog := &Catalog{Entries: []CatalogEntry{
+		{Epic: "EURUSD", InstrumentName: "EUR/USD", InstrumentType: "CURRENCIES", Path: []string{"Forex", "Majors"}},
+		{Epic: "US500", InstrumentName: "US 500, Cash", InstrumentType: "INDICES", Path: []string{"Indices"}},
+	}}
+
+	var buf bytes.Buffer
+	if err := catalog.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "epic,instrumentName,instrumentType,path\n" +
+		"EURUSD,EUR/USD,CURRENCIES,Forex > Majors\n" +
+		"US500,\"US 500, Cash\",INDICES,Indices\n"
+	if buf.String() != want {
+		t.Fatalf("got CSV\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,105 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CloseFilter selects the positions CloseAll closes. Empty fields match
+// every position; all set fields must match.
+type CloseFilter struct {
+	Epic      string
+	Direction Direction
+	Match     func(models.PositionObj) bool
+}
+
+func (f CloseFilter) matches(p models.PositionObj) bool {
+	if f.Epic != "" && p.Market.Epic != f.Epic {
+		return false
+	}
+
+	if f.Direction != "" && p.Position.Direction != string(f.Direction) {
+		return false
+	}
+
+	return f.Match == nil || f.Match(p)
+}
+
+type CloseResult struct {
+	DealID       string
+	Epic         string
+	Direction    Direction
+	Size         float64
+	Confirmation *models.CapitalDealConfirmation
+	Err          error
+}
+
+type CloseAllReport struct {
+	Results []CloseResult
+	Closed  int
+	Failed  int
+}
+
+// Err joins the errors of every close that failed, or returns nil.
+func (r *CloseAllReport) Err() error {
+	var errs []error
+	for _, result := range r.Results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("deal %s: %w", result.DealID, result.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CloseAll closes every open position of the account matching filter. A
+// failed close does not stop the others; each outcome is in the report.
+// The returned error is only set when the positions could not be listed.
+func (c *client) CloseAll(ctx context.Context, demo bool, accountId string, filter CloseFilter, cst, securityToken string) (*CloseAllReport, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := c.getPositions(ctx, demo, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CloseAllReport{}
+	for _, p := range positions.Positions {
+		if !filter.matches(p) {
+			continue
+		}
+
+		result := CloseResult{
+			DealID:    p.Position.DealId,
+			Epic:      p.Market.Epic,
+			Direction: Direction(p.Position.Direction),
+			Size:      p.Position.Size,
+		}
+
+		if err := ctx.Err(); err != nil {
+			result.Err = err
+		} else {
+			result.Confirmation, result.Err = c.closePosition(ctx, demo, p.Position.DealId, cst, securityToken)
+		}
+
+		if result.Err != nil {
+			report.Failed++
+		} else {
+			report.Closed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,142 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrDealRejected   = errors.New("deal rejected")
+	ErrConfirmTimeout = errors.New("deal confirmation not final before deadline")
+)
+
+// ConfirmPolicy controls how long a deal confirmation is polled for. The
+// interval doubles after every poll up to MaxInterval.
+type ConfirmPolicy struct {
+	Timeout     time.Duration
+	Interval    time.Duration
+	MaxInterval time.Duration
+}
+
+func DefaultConfirmPolicy() ConfirmPolicy {
+	return ConfirmPolicy{
+		Timeout:     10 * time.Second,
+		Interval:    200 * time.Millisecond,
+		MaxInterval: 2 * time.Second,
+	}
+}
+
+// DealRejectedError is returned when a confirmation is final but not
+// accepted. It matches ErrDealRejected, and ErrInsufficientFunds when that
+// is the reason.
+type DealRejectedError struct {
+	Reason       models.DealRejectReason
+	Confirmation *models.CapitalDealConfirmation
+}
+
+func (e *DealRejectedError) Error() string {
+	return fmt.Sprintf("deal %s %s: %s", e.Confirmation.DealReference, e.Confirmation.DealStatus, e.Reason)
+}
+
+func (e *DealRejectedError) Is(target error) bool {
+	switch target {
+	case ErrDealRejected:
+		return true
+	case ErrInsufficientFunds:
+		return e.Reason == models.RejectInsufficientFunds
+	}
+
+	return false
+}
+
+func checkAccepted(confirm *models.CapitalDealConfirmation) error {
+	if confirm.DealStatus == models.DealStatusAccepted {
+		return nil
+	}
+
+	return &DealRejectedError{Reason: confirm.Reason, Confirmation: confirm}
+}
+
+// affectedDealID returns the deal the confirmation affected with the given
+// status, falling back to the confirmation's own deal ID and then to the
+// first affected deal.
+func affectedDealID(confirm *models.CapitalDealConfirmation, status string) string {
+	for _, deal := range confirm.AffectedDeals {
+		if deal.Status == status {
+			return deal.DealID
+		}
+	}
+
+	if confirm.DealID != "" {
+		return confirm.DealID
+	}
+
+	if len(confirm.AffectedDeals) > 0 {
+		return confirm.AffectedDeals[0].DealID
+	}
+
+	return ""
+}
+
+// confirmDeal polls the confirmation of a deal on a session that is already
+// switched to the right account, until it is accepted or rejected. A
+// confirmation that does not exist yet is polled like a pending one.
+func (c *client) confirmDeal(ctx context.Context, demo bool, dealReference string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	policy := c.confirmPolicy
+
+	pollCtx := ctx
+	if policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		defer cancel()
+	}
+
+	interval := policy.Interval
+	for {
+		confirm, err := c.fetchConfirm(pollCtx, demo, dealReference, cst, securityToken)
+		switch {
+		case err == nil && (confirm.DealStatus == models.DealStatusAccepted || confirm.DealStatus == models.DealStatusRejected):
+			return confirm, nil
+		case err != nil && ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil && pollCtx.Err() != nil:
+			return nil, fmt.Errorf("%w: deal reference %s", ErrConfirmTimeout, dealReference)
+		case err != nil && !IsNotFound(err):
+			return nil, err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("%w: deal reference %s", ErrConfirmTimeout, dealReference)
+		case <-timer.C:
+		}
+
+		interval *= 2
+		if policy.MaxInterval > 0 && interval > policy.MaxInterval {
+			interval = policy.MaxInterval
+		}
+	}
+}
+
+func (c *client) fetchConfirm(ctx context.Context, demo bool, dealReference string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/confirms/"+dealReference, nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error confirming deal: %w", err)
+	}
+
+	var confirm models.CapitalDealConfirmation
+	if err := json.Unmarshal(data, &confirm); err != nil {
+		return nil, fmt.Errorf("error parsing confirm response: %w", err)
+	}
+
+	return &confirm, nil
+}
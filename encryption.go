@@ -0,0 +1,62 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// EncryptPassword prepares a password for login with encryptedPassword set,
+// as documented by Capital.com: "password|timestamp" is base64 encoded,
+// encrypted with the RSA public key (PKCS#1 v1.5) and base64 encoded again.
+// encryptionKey is the base64 DER key returned by /session/encryptionKey.
+func EncryptPassword(encryptionKey string, timestamp int64, password string) (string, error) {
+	der, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("error decoding encryption key: %w", err)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return "", fmt.Errorf("error parsing encryption key: %w", err)
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return "", errors.New("encryption key is not an RSA public key")
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(password + "|" + strconv.FormatInt(timestamp, 10)))
+
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, []byte(input))
+	if err != nil {
+		return "", fmt.Errorf("error encrypting password: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (c *client) getEncryptionKey(ctx context.Context, demo bool, apiKey string) (*models.EncryptionKeyResponse, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/session/encryptionKey", nil, "", "", apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var response models.EncryptionKeyResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing encryption key response: %w", err)
+	}
+
+	if response.EncryptionKey == "" {
+		return nil, errors.New("empty encryption key")
+	}
+
+	return &response, nil
+}
@@ -0,0 +1,93 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateSessionEncryptsPassword(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const timestamp = int64(1700000000000)
+
+	var got models.CapitalSessionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-CAP-API-KEY") != "api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/session/encryptionKey":
+			json.NewEncoder(w).Encode(models.EncryptionKeyResponse{
+				EncryptionKey: base64.StdEncoding.EncodeToString(der),
+				TimeStamp:     timestamp,
+			})
+		case r.Method == "POST" && r.URL.Path == "/session":
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("CST", "cst")
+			w.Header().Set("X-SECURITY-TOKEN", "token")
+			w.Write([]byte(`{"currentAccountId":"A"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, server.URL, WithEncryptedPassword(), WithRateLimits(RateLimits{}))
+
+	_, tokens, err := c.CreateSession(context.Background(), false, "api-key", "user@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tokens.CST != "cst" || tokens.SecurityToken != "token" {
+		t.Fatalf("unexpected tokens %+v", tokens)
+	}
+
+	if !got.EncryptedPassword {
+		t.Fatal("encryptedPassword was not set")
+	}
+
+	if got.Password == "secret" {
+		t.Fatal("password was sent in plaintext")
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(got.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, key, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := base64.StdEncoding.DecodeString(string(decrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "secret|1700000000000"; string(plain) != want {
+		t.Fatalf("decrypted password is %q, want %q", plain, want)
+	}
+}
@@ -0,0 +1,107 @@
+package capital
+
+import (
+	"capital/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSessionExpired    = errors.New("capital.com session expired or invalid")
+	ErrRateLimited       = errors.New("capital.com rate limit exceeded")
+	ErrInsufficientFunds = errors.New("capital.com insufficient funds")
+	ErrNotFound          = errors.New("capital.com resource not found")
+	ErrInvalidAPIKey     = errors.New("capital.com API key invalid")
+
+	ErrTrailingStopsDisabled    = errors.New("trailing stops are not enabled for this account")
+	ErrTrailingStopNotAvailable = errors.New("trailing stops are not available for this instrument")
+)
+
+// APIError is returned for every response with a status of 400 or above.
+// ErrorCode holds the errorCode field of the body, e.g. error.not-found.dealId.
+type APIError struct {
+	StatusCode int
+	ErrorCode  string
+	Method     string
+	Endpoint   string
+	Body       []byte
+	RetryAfter time.Duration
+}
+
+func newAPIError(method, endpoint string, statusCode int, header http.Header, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Method:     method,
+		Endpoint:   endpoint,
+		Body:       body,
+		RetryAfter: parseRetryAfter(header.Get("Retry-After")),
+	}
+
+	var response models.CapitalErrorResponse
+	if err := json.Unmarshal(body, &response); err == nil {
+		apiErr.ErrorCode = response.ErrorCode
+	}
+
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	detail := e.ErrorCode
+	if detail == "" {
+		detail = strings.TrimSpace(string(e.Body))
+	}
+
+	return fmt.Sprintf("API request %s %s failed with status %d: %s", e.Method, e.Endpoint, e.StatusCode, detail)
+}
+
+func (e *APIError) Is(target error) bool {
+	code := strings.ToLower(e.ErrorCode)
+
+	switch target {
+	case ErrSessionExpired:
+		return e.StatusCode == http.StatusUnauthorized ||
+			code == "error.invalid.session.token" ||
+			code == "error.null.client.token" ||
+			code == "error.null.account.token"
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || strings.HasPrefix(code, "error.too-many.")
+	case ErrInsufficientFunds:
+		return strings.Contains(code, "insufficient") || strings.Contains(code, "not-enough.funds")
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || strings.HasPrefix(code, "error.not-found.")
+	case ErrInvalidAPIKey:
+		return code == "error.invalid.api.key" || strings.HasPrefix(code, "error.security.api-key")
+	}
+
+	return false
+}
+
+func IsSessionExpired(err error) bool {
+	return errors.Is(err, ErrSessionExpired)
+}
+
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+func IsInsufficientFunds(err error) bool {
+	return errors.Is(err, ErrInsufficientFunds)
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// AsAPIError returns the APIError wrapped in err, if any.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+
+	return nil, false
+}
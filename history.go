@@ -0,0 +1,46 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// GetActivityHistory returns the detailed account activity between from and
+// to, which are sent as UTC.
+func (c *client) GetActivityHistory(ctx context.Context, demo bool, accountId string, from, to time.Time, cst, securityToken string) ([]models.Activity, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getActivityHistory(ctx, demo, from, to, cst, securityToken)
+}
+
+func (c *client) getActivityHistory(ctx context.Context, demo bool, from, to time.Time, cst, securityToken string) ([]models.Activity, error) {
+	query := url.Values{}
+	query.Set("from", from.UTC().Format(models.DateTimeLayout))
+	query.Set("to", to.UTC().Format(models.DateTimeLayout))
+	query.Set("detailed", "true")
+
+	data, _, err := c.request(ctx, "GET", demo, "/history/activity?"+query.Encode(), nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting activity history: %w", err)
+	}
+
+	var response models.ActivityHistoryResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing activity history response: %w", err)
+	}
+
+	return response.Activities, nil
+}
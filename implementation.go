@@ -3,6 +3,7 @@ package capital
 import (
 	"bytes"
 	"capital/models"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,11 @@ import (
 	"time"
 )
 
-func (c *client) CreateSession(demo bool, apiKey, identifier, password string) (*models.CreateSessionResponse, *models.SessionTokens, error) {
+func (c *client) CreateSession(ctx context.Context, demo bool, apiKey, identifier, password string) (*models.CreateSessionResponse, *models.SessionTokens, error) {
+	if apiKey == "" {
+		apiKey = c.apiKey
+	}
+
 	if apiKey == "" {
 		return nil, nil, errors.New("capital.com API key is required")
 	}
@@ -20,13 +25,25 @@ func (c *client) CreateSession(demo bool, apiKey, identifier, password string) (
 		return nil, nil, errors.New("capital.com credentials are required")
 	}
 
-	payload := map[string]interface{}{
-		"identifier":        identifier,
-		"password":          password,
-		"encryptedPassword": false,
+	payload := models.CapitalSessionRequest{
+		Identifier: identifier,
+		Password:   password,
+	}
+
+	if c.encryptPassword {
+		encryptionKey, err := c.getEncryptionKey(ctx, demo, apiKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting encryption key: %w", err)
+		}
+
+		payload.Password, err = EncryptPassword(encryptionKey.EncryptionKey, encryptionKey.TimeStamp, password)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error encrypting password: %w", err)
+		}
+		payload.EncryptedPassword = true
 	}
 
-	data, headers, err := c.request("POST", demo, "/session", payload, "", "", apiKey)
+	data, headers, err := c.request(ctx, "POST", demo, "/session", payload, "", "", apiKey)
 
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating session: %w", err)
@@ -45,6 +62,9 @@ func (c *client) CreateSession(demo bool, apiKey, identifier, password string) (
 		return nil, nil, errors.New("failed to obtain session tokens")
 	}
 
+	c.setActiveAccount(cst, session.CurrentAccountId)
+	c.setTrailingStopsEnabled(cst, session.CurrentAccountId, session.TrailingStopsEnabled)
+
 	return &session, &models.SessionTokens{
 		CST:           cst,
 		SecurityToken: securityToken,
@@ -52,92 +72,157 @@ func (c *client) CreateSession(demo bool, apiKey, identifier, password string) (
 	}, nil
 }
 
-func (c *client) OpenPosition(demo bool, accountId, direction, epic string, size float64, stopLevel, profitLevel *float64, guaranteedStop bool, cst, securityToken string) (string, error) {
-	currentAccount, err := c.GetCurrentAccount(demo, cst, securityToken)
+// OpenPosition validates order against the dealing rules of its market and
+// only then submits it. With WithPreTradeChecks, the market status and the
+// current price are checked as well.
+func (c *client) OpenPosition(ctx context.Context, demo bool, accountId string, order OrderRequest, cst, securityToken string) (string, error) {
+	if err := order.Validate(nil); err != nil {
+		return "", err
+	}
+
+	unlock, err := c.lockSession(ctx, cst)
 	if err != nil {
-		return "", fmt.Errorf("error getting current account: %w", err)
+		return "", err
 	}
+	defer unlock()
 
-	if currentAccount.AccountId != accountId {
-		_, sessionTokens, err := c.SwitchActiveAccount(demo, accountId, cst, securityToken)
-		if err != nil {
-			return "", fmt.Errorf("error switching account: %w", err)
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return "", err
+	}
+
+	key := orderKeyID{accountId: accountId, key: order.ClientOrderKey}
+	if key.key != "" {
+		dealID, done, err := c.resumeOrderKey(ctx, demo, key, order.fingerprint(), cst, securityToken)
+		if err != nil || done {
+			return dealID, err
 		}
-		cst = sessionTokens.CST
-		securityToken = sessionTokens.SecurityToken
 	}
 
-	payload := map[string]interface{}{
-		"epic":           epic,
-		"direction":      direction, // "BUY" or "SELL"
-		"size":           size,
-		"guaranteedStop": guaranteedStop,
+	// Nothing is sent before the order passes the dealing rules
+	details, err := c.getMarketDetails(ctx, demo, order.Epic, cst, securityToken)
+	if err != nil {
+		return "", err
 	}
 
-	if stopLevel != nil && *stopLevel != 0.0 {
-		payload["stopLevel"] = *stopLevel
+	if c.preTradeChecks {
+		if _, err := CheckOrder(order, details); err != nil {
+			return "", err
+		}
+	} else if err := order.Validate(&details.DealingRules); err != nil {
+		return "", err
 	}
 
-	if profitLevel != nil && *profitLevel != 0.0 {
-		payload["profitLevel"] = *profitLevel
+	if order.TrailingStop {
+		if err := c.trailingStopsAllowed(cst, accountId); err != nil {
+			return "", err
+		}
+
+		if err := trailingStopsAvailable(order.Epic, details); err != nil {
+			return "", err
+		}
 	}
 
-	data, _, err := c.request("POST", demo, "/positions", payload, cst, securityToken, "")
+	// Whatever is open now cannot have been opened by this order
+	existing, err := c.existingDeals(ctx, demo, models.ActivityTypePosition, cst, securityToken)
 	if err != nil {
+		return "", err
+	}
+
+	if key.key != "" {
+		c.beginOrderKey(key, order.fingerprint(), existing)
+	}
+
+	response, dealID, err := c.submitPosition(ctx, demo, order, existing, cst, securityToken)
+	if err != nil {
+		c.failOrderKey(key, err)
 		return "", fmt.Errorf("error opening position: %w", err)
 	}
 
-	var response models.CapitalDealReference
-	if err := json.Unmarshal(data, &response); err != nil {
-		return "", fmt.Errorf("error parsing position response: %w", err)
+	if dealID != "" {
+		c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealID = dealID })
+		return dealID, nil
 	}
 
+	c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealReference = response.DealReference })
+
 	// Verify that the position was actually opened
-	confirm, err := c.ConfirmDeal(demo, accountId, response.DealReference, cst, securityToken)
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
 	if err != nil {
 		return "", fmt.Errorf("error confirming deal: %w", err)
 	}
 
-	if confirm.DealStatus != "ACCEPTED" {
-		return "", fmt.Errorf("deal was not accepted: %s", confirm.Status)
+	if err := checkAccepted(confirm); err != nil {
+		c.forgetOrderKey(key)
+		return "", fmt.Errorf("deal was not accepted: %w", err)
 	}
 
-	if len(confirm.AffectedDeals) == 0 {
+	dealID = affectedDealID(confirm, models.AffectedDealOpened)
+	if dealID == "" {
 		return "", fmt.Errorf("no affected deals found")
 	}
 
-	return confirm.AffectedDeals[0].DealID, nil
+	c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealID = dealID })
+
+	return dealID, nil
 }
 
-func (c *client) ClosePosition(demo bool, accountId, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
-	currentAccount, err := c.GetCurrentAccount(demo, cst, securityToken)
+// submitPosition posts a new position. If the outcome of the POST is unknown,
+// it looks for a position the request may have opened before sending it again,
+// so a retry never opens a duplicate trade. existing holds the positions open
+// before the first attempt. A non-empty dealID means such a position was
+// found and no deal reference is available.
+func (c *client) submitPosition(ctx context.Context, demo bool, order OrderRequest, existing map[string]bool, cst, securityToken string) (*models.CapitalDealReference, string, error) {
+	payload := order.payload()
+	submittedAt := time.Now()
+
+	// This loop is the only retry layer, so each send is a single attempt
+	data, _, err := c.requestAttempts(ctx, 1, "POST", demo, "/positions", payload, cst, securityToken, "")
+	for attempt := 1; err != nil && isTransient(ctx, err) && attempt < c.retryPolicy.attempts(); attempt++ {
+		if err := c.retryPolicy.wait(ctx, attempt, err); err != nil {
+			return nil, "", err
+		}
+
+		dealID, findErr := c.reconcileOrder(ctx, demo, order.fingerprint(), submittedAt, existing, cst, securityToken)
+		if findErr != nil {
+			// Without knowing whether the first POST went through, resending is unsafe
+			continue
+		}
+		if dealID != "" {
+			return nil, dealID, nil
+		}
+
+		data, _, err = c.requestAttempts(ctx, 1, "POST", demo, "/positions", payload, cst, securityToken, "")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error getting current account: %w", err)
+		return nil, "", err
 	}
 
-	if currentAccount.AccountId != accountId {
-		_, sessionTokens, err := c.SwitchActiveAccount(demo, accountId, cst, securityToken)
-		if err != nil {
-			return nil, fmt.Errorf("error switching account: %w", err)
-		}
-		cst = sessionTokens.CST
-		securityToken = sessionTokens.SecurityToken
+	var response models.CapitalDealReference
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, "", fmt.Errorf("error parsing position response: %w", err)
 	}
 
-	data, _, err := c.request("GET", demo, "/positions/"+dealID, nil, cst, securityToken, "")
+	return &response, "", nil
+}
+
+func (c *client) ClosePosition(ctx context.Context, demo bool, accountId, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	unlock, err := c.lockSession(ctx, cst)
 	if err != nil {
-		return nil, fmt.Errorf("error getting position details: %w", err)
+		return nil, err
 	}
+	defer unlock()
 
-	var posResponse struct {
-		Position models.CapitalPosition `json:"position"`
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := json.Unmarshal(data, &posResponse); err != nil {
-		return nil, fmt.Errorf("error parsing position details: %w", err)
-	}
+	return c.closePosition(ctx, demo, dealID, cst, securityToken)
+}
 
-	closeData, _, err := c.request("DELETE", demo, fmt.Sprintf("/positions/%s", dealID), nil, cst, securityToken, "")
+func (c *client) closePosition(ctx context.Context, demo bool, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	closeData, _, err := c.request(ctx, "DELETE", demo, fmt.Sprintf("/positions/%s", dealID), nil, cst, securityToken, "")
 	if err != nil {
 		return nil, fmt.Errorf("error closing position: %w", err)
 	}
@@ -148,62 +233,166 @@ func (c *client) ClosePosition(demo bool, accountId, dealID string, cst, securit
 	}
 
 	// Verify that the position was actually closed
-	confirm, err := c.ConfirmDeal(demo, accountId, response.DealReference, cst, securityToken)
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
 	if err != nil {
 		return nil, fmt.Errorf("error confirming position close: %w", err)
 	}
 
-	if confirm.DealStatus != "ACCEPTED" {
-		return nil, fmt.Errorf("position close not accepted: %s", confirm.Status)
+	if err := checkAccepted(confirm); err != nil {
+		return nil, fmt.Errorf("position close not accepted: %w", err)
 	}
 
 	return confirm, nil
 }
 
-func (c *client) ConfirmDeal(demo bool, accountId, dealReference string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
-	currentAccount, err := c.GetCurrentAccount(demo, cst, securityToken)
+func (c *client) UpdatePosition(ctx context.Context, demo bool, accountId, dealID string, update models.UpdatePositionRequest, cst, securityToken string) (*models.PositionObj, error) {
+	stops := countSet(update.StopLevel, update.StopDistance, update.StopAmount)
+	if stops > 1 || (stops > 0 && update.RemoveStop) {
+		return nil, errors.New("only one of stop level, distance, amount or removal may be set")
+	}
+
+	profits := countSet(update.ProfitLevel, update.ProfitDistance, update.ProfitAmount)
+	if profits > 1 || (profits > 0 && update.RemoveProfit) {
+		return nil, errors.New("only one of profit level, distance, amount or removal may be set")
+	}
+
+	unlock, err := c.lockSession(ctx, cst)
 	if err != nil {
-		return nil, fmt.Errorf("error getting current account: %w", err)
+		return nil, err
 	}
+	defer unlock()
 
-	if currentAccount.AccountId != accountId {
-		_, sessionTokens, err := c.SwitchActiveAccount(demo, accountId, cst, securityToken)
-		if err != nil {
-			return nil, fmt.Errorf("error switching account: %w", err)
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.getPosition(ctx, demo, dealID, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// The update replaces the stop and limit of the position, so carry over
+	// whatever the caller did not ask to change
+	trailing := current.Position.TrailingStop
+	if update.TrailingStop != nil {
+		trailing = *update.TrailingStop
+	}
+
+	payload := map[string]interface{}{
+		"guaranteedStop": current.Position.GuaranteedStop,
+		"trailingStop":   trailing,
+	}
+
+	if update.GuaranteedStop != nil {
+		payload["guaranteedStop"] = *update.GuaranteedStop
+	}
+
+	switch {
+	case update.StopLevel != nil:
+		payload["stopLevel"] = *update.StopLevel
+	case update.StopDistance != nil:
+		payload["stopDistance"] = *update.StopDistance
+	case update.StopAmount != nil:
+		payload["stopAmount"] = *update.StopAmount
+	case update.RemoveStop:
+	case trailing && current.Position.StopDistance != 0:
+		payload["stopDistance"] = current.Position.StopDistance
+	case current.Position.StopLevel != 0:
+		payload["stopLevel"] = current.Position.StopLevel
+	}
+
+	if trailing {
+		if _, ok := payload["stopDistance"]; !ok || payload["guaranteedStop"] == true {
+			return nil, errors.New("a trailing stop requires a stop distance and no guaranteed stop")
 		}
-		cst = sessionTokens.CST
-		securityToken = sessionTokens.SecurityToken
+
+		if !current.Position.TrailingStop {
+			if err := c.checkTrailingStops(ctx, demo, accountId, current.Market.Epic, cst, securityToken); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch {
+	case update.ProfitLevel != nil:
+		payload["profitLevel"] = *update.ProfitLevel
+	case update.ProfitDistance != nil:
+		payload["profitDistance"] = *update.ProfitDistance
+	case update.ProfitAmount != nil:
+		payload["profitAmount"] = *update.ProfitAmount
+	case !update.RemoveProfit && current.Position.ProfitLevel != 0:
+		payload["profitLevel"] = current.Position.ProfitLevel
 	}
 
-	data, _, err := c.request("GET", demo, "/confirms/"+dealReference, nil, cst, securityToken, "")
+	data, _, err := c.request(ctx, "PUT", demo, "/positions/"+dealID, payload, cst, securityToken, "")
 	if err != nil {
-		return nil, fmt.Errorf("error confirming deal: %w", err)
+		return nil, fmt.Errorf("error updating position: %w", err)
 	}
 
-	var confirm models.CapitalDealConfirmation
-	if err := json.Unmarshal(data, &confirm); err != nil {
-		return nil, fmt.Errorf("error parsing confirm response: %w", err)
+	var response models.CapitalDealReference
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing update position response: %w", err)
 	}
 
-	return &confirm, nil
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
+	if err != nil {
+		return nil, fmt.Errorf("error confirming position update: %w", err)
+	}
+
+	if err := checkAccepted(confirm); err != nil {
+		return nil, fmt.Errorf("position update not accepted: %w", err)
+	}
+
+	return c.getPosition(ctx, demo, dealID, cst, securityToken)
 }
 
-func (c *client) GetPositions(demo bool, accountId, cst, securityToken string) (*models.PositionsResponse, error) {
-	currentAccount, err := c.GetCurrentAccount(demo, cst, securityToken)
+func (c *client) getPosition(ctx context.Context, demo bool, dealID string, cst, securityToken string) (*models.PositionObj, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/positions/"+dealID, nil, cst, securityToken, "")
 	if err != nil {
-		return nil, fmt.Errorf("error getting current account: %w", err)
+		return nil, fmt.Errorf("error getting position details: %w", err)
 	}
 
-	if currentAccount.AccountId != accountId {
-		_, sessionTokens, err := c.SwitchActiveAccount(demo, accountId, cst, securityToken)
-		if err != nil {
-			return nil, fmt.Errorf("error switching account: %w", err)
-		}
-		cst = sessionTokens.CST
-		securityToken = sessionTokens.SecurityToken
+	var response models.PositionObj
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing position details: %w", err)
 	}
 
-	data, _, err := c.request("GET", demo, "/positions", nil, cst, securityToken, "")
+	return &response, nil
+}
+
+func (c *client) ConfirmDeal(ctx context.Context, demo bool, accountId, dealReference string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.confirmDeal(ctx, demo, dealReference, cst, securityToken)
+}
+
+func (c *client) GetPositions(ctx context.Context, demo bool, accountId, cst, securityToken string) (*models.PositionsResponse, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getPositions(ctx, demo, cst, securityToken)
+}
+
+func (c *client) getPositions(ctx context.Context, demo bool, cst, securityToken string) (*models.PositionsResponse, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/positions", nil, cst, securityToken, "")
 	if err != nil {
 		return nil, fmt.Errorf("error getting positions: %w", err)
 	}
@@ -216,22 +405,23 @@ func (c *client) GetPositions(demo bool, accountId, cst, securityToken string) (
 	return &response, nil
 }
 
-func (c *client) GetMarketDetails(demo bool, accountId, epic string, cst, securityToken string) (*models.CapitalMarketDetailsResponse, error) {
-	currentAccount, err := c.GetCurrentAccount(demo, cst, securityToken)
+func (c *client) GetMarketDetails(ctx context.Context, demo bool, accountId, epic string, cst, securityToken string) (*models.CapitalMarketDetailsResponse, error) {
+	unlock, err := c.lockSession(ctx, cst)
 	if err != nil {
-		return nil, fmt.Errorf("error getting current account: %w", err)
+		return nil, err
 	}
+	defer unlock()
 
-	if currentAccount.AccountId != accountId {
-		_, sessionTokens, err := c.SwitchActiveAccount(demo, accountId, cst, securityToken)
-		if err != nil {
-			return nil, fmt.Errorf("error switching account: %w", err)
-		}
-		cst = sessionTokens.CST
-		securityToken = sessionTokens.SecurityToken
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
 	}
 
-	data, _, err := c.request("GET", demo, "/markets/"+epic, nil, cst, securityToken, "")
+	return c.getMarketDetails(ctx, demo, epic, cst, securityToken)
+}
+
+func (c *client) getMarketDetails(ctx context.Context, demo bool, epic string, cst, securityToken string) (*models.CapitalMarketDetailsResponse, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/markets/"+epic, nil, cst, securityToken, "")
 	if err != nil {
 		return nil, fmt.Errorf("error getting market details: %w", err)
 	}
@@ -244,8 +434,8 @@ func (c *client) GetMarketDetails(demo bool, accountId, epic string, cst, securi
 	return &response, nil
 }
 
-func (c *client) GetAccounts(demo bool, cst, securityToken string) ([]models.CapitalAccount, error) {
-	data, _, err := c.request("GET", demo, "/accounts", nil, cst, securityToken, "")
+func (c *client) GetAccounts(ctx context.Context, demo bool, cst, securityToken string) ([]models.CapitalAccount, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/accounts", nil, cst, securityToken, "")
 	if err != nil {
 		return nil, fmt.Errorf("error getting accounts: %w", err)
 	}
@@ -258,12 +448,22 @@ func (c *client) GetAccounts(demo bool, cst, securityToken string) ([]models.Cap
 	return response.Accounts, nil
 }
 
-func (c *client) SwitchActiveAccount(demo bool, accountId string, cst, securityToken string) (*models.SwitchAccountResponse, *models.SessionTokens, error) {
+func (c *client) SwitchActiveAccount(ctx context.Context, demo bool, accountId string, cst, securityToken string) (*models.SwitchAccountResponse, *models.SessionTokens, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	return c.switchAccount(ctx, demo, accountId, cst, securityToken)
+}
+
+func (c *client) switchAccount(ctx context.Context, demo bool, accountId string, cst, securityToken string) (*models.SwitchAccountResponse, *models.SessionTokens, error) {
 	payload := map[string]interface{}{
 		"accountId": accountId,
 	}
 
-	data, headers, err := c.request("PUT", demo, "/session", payload, cst, securityToken, "")
+	data, headers, err := c.request(ctx, "PUT", demo, "/session", payload, cst, securityToken, "")
 	if err != nil {
 		return nil, nil, fmt.Errorf("error switching account: %w", err)
 	}
@@ -273,15 +473,31 @@ func (c *client) SwitchActiveAccount(demo bool, accountId string, cst, securityT
 		return nil, nil, fmt.Errorf("error parsing switch account response: %w", err)
 	}
 
-	return &response, &models.SessionTokens{
+	// The switch response only carries tokens when the server rotated them
+	tokens := &models.SessionTokens{
 		CST:           headers.Get("CST"),
 		SecurityToken: headers.Get("X-SECURITY-TOKEN"),
 		Timestamp:     time.Now(),
-	}, nil
+	}
+	if tokens.CST == "" {
+		tokens.CST = cst
+	}
+	if tokens.SecurityToken == "" {
+		tokens.SecurityToken = securityToken
+	}
+	c.aliasSession(cst, tokens.CST)
+	c.setActiveAccount(cst, accountId)
+	c.setTrailingStopsEnabled(cst, accountId, response.TrailingStopsEnabled)
+	notifyTokens(ctx, tokens)
+
+	return &response, tokens, nil
 }
 
-func (c *client) GetCurrentAccount(demo bool, cst, securityToken string) (*models.CurrentAccount, error) {
-	data, _, err := c.request("GET", demo, "/session", nil, cst, securityToken, "")
+// GetCurrentAccount returns the account active on the session. It leaves the
+// cached active account alone: the answer may be stale by the time it
+// arrives, so only callers holding the session lock write the cache.
+func (c *client) GetCurrentAccount(ctx context.Context, demo bool, cst, securityToken string) (*models.CurrentAccount, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/session", nil, cst, securityToken, "")
 	if err != nil {
 		return nil, fmt.Errorf("error getting session info: %w", err)
 	}
@@ -294,7 +510,105 @@ func (c *client) GetCurrentAccount(demo bool, cst, securityToken string) (*model
 	return &response, nil
 }
 
-func (c *client) request(method string, demo bool, endpoint string, payload interface{}, cst, securityToken, apiKey string) ([]byte, http.Header, error) {
+// GetSessionInfo combines GET /session with the balance and details of the
+// account that is currently active on the session.
+func (c *client) GetSessionInfo(ctx context.Context, demo bool, cst, securityToken string) (*models.SessionInfo, error) {
+	currentAccount, err := c.GetCurrentAccount(ctx, demo, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := c.GetAccounts(ctx, demo, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &models.SessionInfo{CurrentAccount: *currentAccount}
+	for _, account := range accounts {
+		if account.AccountID == currentAccount.AccountId {
+			info.ActiveAccount = account
+			break
+		}
+	}
+
+	return info, nil
+}
+
+func (c *client) Ping(ctx context.Context, demo bool, cst, securityToken string) error {
+	if _, _, err := c.request(ctx, "GET", demo, "/ping", nil, cst, securityToken, ""); err != nil {
+		return fmt.Errorf("error pinging session: %w", err)
+	}
+
+	return nil
+}
+
+func (c *client) Logout(ctx context.Context, demo bool, cst, securityToken string) error {
+	c.forgetSession(cst)
+
+	if _, _, err := c.request(ctx, "DELETE", demo, "/session", nil, cst, securityToken, ""); err != nil {
+		return fmt.Errorf("error logging out: %w", err)
+	}
+
+	return nil
+}
+
+func (c *client) request(ctx context.Context, method string, demo bool, endpoint string, payload interface{}, cst, securityToken, apiKey string) ([]byte, http.Header, error) {
+	return c.requestAttempts(ctx, c.retryPolicy.attempts(), method, demo, endpoint, payload, cst, securityToken, apiKey)
+}
+
+// requestAttempts sends a request up to attempts times, retrying the
+// failures shouldRetry allows.
+func (c *client) requestAttempts(ctx context.Context, attempts int, method string, demo bool, endpoint string, payload interface{}, cst, securityToken, apiKey string) ([]byte, http.Header, error) {
+	var payloadBytes []byte
+	if payload != nil {
+		var err error
+		payloadBytes, err = json.Marshal(payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshaling request payload: %w", err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, headers, err := c.send(ctx, method, demo, endpoint, payloadBytes, cst, securityToken, apiKey)
+		if isAccountMismatch(err) {
+			c.setActiveAccount(cst, "")
+		}
+
+		// A rejected session means the server never looked at the order
+		if placesOrder(method, endpoint) && !IsSessionExpired(err) {
+			notifySubmitted(ctx)
+		}
+
+		if err == nil || attempt >= attempts || !shouldRetry(ctx, method, err) {
+			return body, headers, err
+		}
+
+		c.logger.WarnContext(ctx, "retrying capital.com request", "method", method, "endpoint", endpoint, "attempt", attempt, "error", err)
+
+		if err := c.retryPolicy.wait(ctx, attempt, err); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// placesOrder reports whether a request opens, reduces or creates a deal,
+// so that sending it twice could trade twice.
+func placesOrder(method, endpoint string) bool {
+	return method == "POST" && (endpoint == "/positions" || endpoint == "/workingorders")
+}
+
+func (c *client) send(ctx context.Context, method string, demo bool, endpoint string, payload []byte, cst, securityToken, apiKey string) ([]byte, http.Header, error) {
+	// The timeout covers the request only, not the wait for a rate limit slot
+	if err := c.limiters.wait(ctx, method, demo, endpoint); err != nil {
+		return nil, nil, fmt.Errorf("error waiting for rate limit: %w", err)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
 	baseURL := c.baseURL
 	if demo {
 		baseURL = c.demoBaseURL
@@ -303,14 +617,10 @@ func (c *client) request(method string, demo bool, endpoint string, payload inte
 
 	var bodyReader io.Reader
 	if payload != nil {
-		payloadBytes, err := json.Marshal(payload)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error marshaling request payload: %w", err)
-		}
-		bodyReader = bytes.NewBuffer(payloadBytes)
+		bodyReader = bytes.NewReader(payload)
 	}
 
-	req, err := http.NewRequest(method, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating API request: %w", err)
 	}
@@ -331,19 +641,27 @@ func (c *client) request(method string, demo bool, endpoint string, payload inte
 		req.Header.Set("X-CAP-API-KEY", apiKey)
 	}
 
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		c.logger.DebugContext(ctx, "capital.com request failed", "method", method, "endpoint", endpoint, "error", err)
 		return nil, nil, fmt.Errorf("error making API request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	c.logger.DebugContext(ctx, "capital.com request", "method", method, "endpoint", endpoint, "status", resp.StatusCode, "duration", time.Since(start))
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, nil, newAPIError(method, endpoint, resp.StatusCode, resp.Header, body)
 	}
 
 	return body, resp.Header, nil
@@ -0,0 +1,99 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MaxEpicsPerRequest is the most epics Capital.com accepts in one
+// GET /markets request.
+const MaxEpicsPerRequest = 50
+
+// SearchMarkets returns the markets whose name or epic matches term.
+func (c *client) SearchMarkets(ctx context.Context, demo bool, term string, cst, securityToken string) ([]models.Market, error) {
+	if strings.TrimSpace(term) == "" {
+		return nil, errors.New("search term is required")
+	}
+
+	data, _, err := c.request(ctx, "GET", demo, "/markets?searchTerm="+url.QueryEscape(term), nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error searching markets: %w", err)
+	}
+
+	var response models.MarketsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing markets response: %w", err)
+	}
+
+	return response.Markets, nil
+}
+
+// GetMarketSnapshots returns the current snapshot of every epic, in the
+// order given; epics the server does not know are left out. Epics are
+// requested MaxEpicsPerRequest at a time.
+func (c *client) GetMarketSnapshots(ctx context.Context, demo bool, epics []string, cst, securityToken string) ([]models.CapitalMarket, error) {
+	byEpic := make(map[string]models.CapitalMarket, len(epics))
+
+	for start := 0; start < len(epics); start += MaxEpicsPerRequest {
+		end := start + MaxEpicsPerRequest
+		if end > len(epics) {
+			end = len(epics)
+		}
+
+		details, err := c.getMarketDetailsList(ctx, demo, epics[start:end], cst, securityToken)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range details {
+			byEpic[d.Instrument.Epic] = marketSnapshot(d)
+		}
+	}
+
+	snapshots := make([]models.CapitalMarket, 0, len(epics))
+	for _, epic := range epics {
+		if snapshot, ok := byEpic[epic]; ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	return snapshots, nil
+}
+
+func (c *client) getMarketDetailsList(ctx context.Context, demo bool, epics []string, cst, securityToken string) ([]models.CapitalMarketDetailsResponse, error) {
+	escaped := make([]string, len(epics))
+	for i, epic := range epics {
+		escaped[i] = url.QueryEscape(epic)
+	}
+
+	data, _, err := c.request(ctx, "GET", demo, "/markets?epics="+strings.Join(escaped, ","), nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting market snapshots: %w", err)
+	}
+
+	var response models.MarketDetailsListResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing market snapshots response: %w", err)
+	}
+
+	return response.MarketDetails, nil
+}
+
+func marketSnapshot(details models.CapitalMarketDetailsResponse) models.CapitalMarket {
+	return models.CapitalMarket{
+		Epic:                     details.Instrument.Epic,
+		MarketStatus:             details.Snapshot.MarketStatus,
+		NetChange:                details.Snapshot.NetChange,
+		PercentageChange:         details.Snapshot.PercentageChange,
+		Bid:                      details.Snapshot.Bid,
+		Offer:                    details.Snapshot.Offer,
+		UpdateTime:               details.Snapshot.UpdateTime,
+		DelayTime:                details.Snapshot.DelayTime,
+		StreamingPricesAvailable: details.Instrument.StreamingPricesAvailable,
+	}
+}
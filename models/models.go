@@ -1,6 +1,88 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Direction is the side of an order or position.
+type Direction string
+
+const (
+	DirectionBuy  Direction = "BUY"
+	DirectionSell Direction = "SELL"
+)
+
+func (d Direction) Valid() bool {
+	return d == DirectionBuy || d == DirectionSell
+}
+
+func (d Direction) Opposite() Direction {
+	if d == DirectionBuy {
+		return DirectionSell
+	}
+
+	return DirectionBuy
+}
+
+const (
+	WorkingOrderTypeLimit = "LIMIT"
+	WorkingOrderTypeStop  = "STOP"
+
+	TrailingStopsAvailable = "AVAILABLE"
+
+	DealStatusAccepted = "ACCEPTED"
+	DealStatusRejected = "REJECTED"
+
+	AffectedDealOpened          = "OPENED"
+	AffectedDealAmended         = "AMENDED"
+	AffectedDealPartiallyClosed = "PARTIALLY_CLOSED"
+	AffectedDealFullyClosed     = "FULLY_CLOSED"
+	AffectedDealDeleted         = "DELETED"
+
+	ActivityTypePosition     = "POSITION"
+	ActivityTypeWorkingOrder = "WORKING_ORDER"
+
+	InstrumentTypeShares           = "SHARES"
+	InstrumentTypeCurrencies       = "CURRENCIES"
+	InstrumentTypeIndices          = "INDICES"
+	InstrumentTypeCryptocurrencies = "CRYPTOCURRENCIES"
+	InstrumentTypeCommodities      = "COMMODITIES"
+
+	MarketStatusTradeable = "TRADEABLE"
+	MarketStatusClosed    = "CLOSED"
+	MarketStatusEditsOnly = "EDITS_ONLY"
+
+	// DateTimeLayout is the format of goodTillDate and other local timestamps.
+	DateTimeLayout = "2006-01-02T15:04:05"
+)
+
+// DealRejectReason is the reason field of a deal confirmation.
+type DealRejectReason string
+
+const (
+	RejectSuccess                      DealRejectReason = "SUCCESS"
+	RejectUnknown                      DealRejectReason = "UNKNOWN"
+	RejectMarketClosed                 DealRejectReason = "MARKET_CLOSED"
+	RejectMarketClosedWithEdits        DealRejectReason = "MARKET_CLOSED_WITH_EDITS"
+	RejectMarketOffline                DealRejectReason = "MARKET_OFFLINE"
+	RejectMarketNotBorrowable          DealRejectReason = "MARKET_NOT_BORROWABLE"
+	RejectInsufficientFunds            DealRejectReason = "INSUFFICIENT_FUNDS"
+	RejectMinimumOrderSize             DealRejectReason = "MINIMUM_ORDER_SIZE_ERROR"
+	RejectMaxAutoSizeExceeded          DealRejectReason = "MAX_AUTO_SIZE_EXCEEDED"
+	RejectAttachedOrderLevel           DealRejectReason = "ATTACHED_ORDER_LEVEL_ERROR"
+	RejectAttachedOrderTrailingStop    DealRejectReason = "ATTACHED_ORDER_TRAILING_STOP_ERROR"
+	RejectCannotChangeStopType         DealRejectReason = "CANNOT_CHANGE_STOP_TYPE"
+	RejectCannotRemoveStop             DealRejectReason = "CANNOT_REMOVE_STOP"
+	RejectClosingOnlyTradesAccepted    DealRejectReason = "CLOSING_ONLY_TRADES_ACCEPTED_ON_THIS_MARKET"
+	RejectPositionNotAvailableToClose  DealRejectReason = "POSITION_NOT_AVAILABLE_TO_CLOSE"
+	RejectPositionNotAvailableToCancel DealRejectReason = "POSITION_NOT_AVAILABLE_TO_CANCEL"
+	RejectOrderNotFound                DealRejectReason = "ORDER_NOT_FOUND"
+	RejectWrongSideOfMarket            DealRejectReason = "WRONG_SIDE_OF_MARKET"
+	RejectRiskCheck                    DealRejectReason = "RISK_CHECK"
+	RejectMarketPhoneOnly              DealRejectReason = "MARKET_PHONE_ONLY"
+	RejectDuplicateOrder               DealRejectReason = "DUPLICATE_ORDER_ERROR"
+)
 
 type (
 	SessionTokens struct {
@@ -45,11 +127,24 @@ type (
 	}
 
 	CapitalDealConfirmation struct {
-		Status        string         `json:"status"`
-		DealStatus    string         `json:"dealStatus"`
-		DealReference string         `json:"dealReference"`
-		AffectedDeals []AffectedDeal `json:"affectedDeals"`
-		Reason        string         `json:"reason,omitempty"`
+		Date           string           `json:"date"`
+		Status         string           `json:"status"`
+		DealStatus     string           `json:"dealStatus"`
+		DealReference  string           `json:"dealReference"`
+		DealID         string           `json:"dealId"`
+		Epic           string           `json:"epic"`
+		Expiry         string           `json:"expiry"`
+		Direction      string           `json:"direction"`
+		Level          float64          `json:"level"`
+		Size           float64          `json:"size"`
+		StopLevel      float64          `json:"stopLevel,omitempty"`
+		StopDistance   float64          `json:"stopDistance,omitempty"`
+		ProfitLevel    float64          `json:"profitLevel,omitempty"`
+		ProfitDistance float64          `json:"profitDistance,omitempty"`
+		GuaranteedStop bool             `json:"guaranteedStop"`
+		TrailingStop   bool             `json:"trailingStop"`
+		AffectedDeals  []AffectedDeal   `json:"affectedDeals"`
+		Reason         DealRejectReason `json:"reason,omitempty"`
 	}
 
 	AffectedDeal struct {
@@ -57,15 +152,190 @@ type (
 		Status string `json:"status"`
 	}
 
+	WorkingOrderRequest struct {
+		// ClientOrderKey makes resubmitting the request idempotent; it is
+		// kept by the client and not sent to Capital.com
+		ClientOrderKey string    `json:"-"`
+		Direction      Direction `json:"direction"`
+		Epic           string    `json:"epic"`
+		Size           float64   `json:"size"`
+		Level          float64   `json:"level"`
+		Type           string    `json:"type"`
+		GoodTillDate   time.Time `json:"-"`
+		GuaranteedStop bool      `json:"guaranteedStop,omitempty"`
+		TrailingStop   bool      `json:"trailingStop,omitempty"`
+		StopLevel      *float64  `json:"stopLevel,omitempty"`
+		StopDistance   *float64  `json:"stopDistance,omitempty"`
+		StopAmount     *float64  `json:"stopAmount,omitempty"`
+		ProfitLevel    *float64  `json:"profitLevel,omitempty"`
+		ProfitDistance *float64  `json:"profitDistance,omitempty"`
+		ProfitAmount   *float64  `json:"profitAmount,omitempty"`
+	}
+
+	UpdateWorkingOrderRequest struct {
+		Level          *float64   `json:"level,omitempty"`
+		GoodTillDate   *time.Time `json:"-"`
+		GuaranteedStop *bool      `json:"guaranteedStop,omitempty"`
+		TrailingStop   *bool      `json:"trailingStop,omitempty"`
+		StopLevel      *float64   `json:"stopLevel,omitempty"`
+		StopDistance   *float64   `json:"stopDistance,omitempty"`
+		StopAmount     *float64   `json:"stopAmount,omitempty"`
+		ProfitLevel    *float64   `json:"profitLevel,omitempty"`
+		ProfitDistance *float64   `json:"profitDistance,omitempty"`
+		ProfitAmount   *float64   `json:"profitAmount,omitempty"`
+	}
+
+	WorkingOrdersResponse struct {
+		WorkingOrders []WorkingOrderObj `json:"workingOrders"`
+	}
+
+	WorkingOrderObj struct {
+		WorkingOrderData WorkingOrder `json:"workingOrderData"`
+		MarketData       Market       `json:"marketData"`
+	}
+
+	WorkingOrder struct {
+		DealId          string    `json:"dealId"`
+		Direction       Direction `json:"direction"`
+		Epic            string    `json:"epic"`
+		OrderSize       float64   `json:"orderSize"`
+		Leverage        int       `json:"leverage"`
+		OrderLevel      float64   `json:"orderLevel"`
+		OrderType       string    `json:"orderType"`
+		TimeInForce     string    `json:"timeInForce"`
+		GoodTillDate    string    `json:"goodTillDate"`
+		GoodTillDateUTC string    `json:"goodTillDateUTC"`
+		CreatedDate     string    `json:"createdDate"`
+		CreatedDateUTC  string    `json:"createdDateUTC"`
+		GuaranteedStop  bool      `json:"guaranteedStop"`
+		TrailingStop    bool      `json:"trailingStop"`
+		StopLevel       float64   `json:"stopLevel,omitempty"`
+		StopDistance    float64   `json:"stopDistance,omitempty"`
+		ProfitLevel     float64   `json:"profitLevel,omitempty"`
+		ProfitDistance  float64   `json:"profitDistance,omitempty"`
+		CurrencyCode    string    `json:"currencyCode"`
+	}
+
+	ActivityHistoryResponse struct {
+		Activities []Activity `json:"activities"`
+	}
+
+	Activity struct {
+		Date    string           `json:"date"`
+		DateUTC string           `json:"dateUTC"`
+		Epic    string           `json:"epic"`
+		DealId  string           `json:"dealId"`
+		Source  string           `json:"source"`
+		Type    string           `json:"type"`
+		Status  string           `json:"status"`
+		Details *ActivityDetails `json:"details,omitempty"`
+	}
+
+	ActivityDetails struct {
+		DealReference  string           `json:"dealReference"`
+		MarketName     string           `json:"marketName"`
+		Currency       string           `json:"currency"`
+		Direction      string           `json:"direction"`
+		Size           float64          `json:"size"`
+		Level          float64          `json:"level"`
+		GoodTillDate   string           `json:"goodTillDate,omitempty"`
+		StopLevel      float64          `json:"stopLevel,omitempty"`
+		StopDistance   float64          `json:"stopDistance,omitempty"`
+		ProfitLevel    float64          `json:"profitLevel,omitempty"`
+		ProfitDistance float64          `json:"profitDistance,omitempty"`
+		GuaranteedStop bool             `json:"guaranteedStop"`
+		TrailingStop   bool             `json:"trailingStop"`
+		Actions        []ActivityAction `json:"actions"`
+	}
+
+	ActivityAction struct {
+		ActionType     string `json:"actionType"`
+		AffectedDealId string `json:"affectedDealId"`
+	}
+
+	PricesResponse struct {
+		Prices         []PriceBar `json:"prices"`
+		InstrumentType string     `json:"instrumentType"`
+	}
+
+	// PriceBar is one OHLC bar. Time is parsed from SnapshotTimeUTC by the
+	// client.
+	PriceBar struct {
+		Time             time.Time `json:"-"`
+		SnapshotTime     string    `json:"snapshotTime"`
+		SnapshotTimeUTC  string    `json:"snapshotTimeUTC"`
+		OpenPrice        BidAsk    `json:"openPrice"`
+		ClosePrice       BidAsk    `json:"closePrice"`
+		HighPrice        BidAsk    `json:"highPrice"`
+		LowPrice         BidAsk    `json:"lowPrice"`
+		LastTradedVolume float64   `json:"lastTradedVolume"`
+	}
+
+	BidAsk struct {
+		Bid float64 `json:"bid"`
+		Ask float64 `json:"ask"`
+	}
+
 	CapitalMarketDetailsResponse struct {
-		DealingRules DealingRules `json:"dealingRules"`
-		Instrument   Instrument   `json:"instrument"`
+		DealingRules DealingRules   `json:"dealingRules"`
+		Instrument   Instrument     `json:"instrument"`
+		Snapshot     MarketSnapshot `json:"snapshot"`
+	}
+
+	MarketSnapshot struct {
+		MarketStatus     string  `json:"marketStatus"`
+		NetChange        float64 `json:"netChange"`
+		PercentageChange float64 `json:"percentageChange"`
+		High             float64 `json:"high"`
+		Low              float64 `json:"low"`
+		Bid              float64 `json:"bid"`
+		Offer            float64 `json:"offer"`
+		UpdateTime       string  `json:"updateTime"`
+		DelayTime        int     `json:"delayTime"`
+
+		// DecimalPlacesFactor is the number of decimal places of the prices,
+		// ScalingFactor the factor by which they are multiplied for display
+		DecimalPlacesFactor int      `json:"decimalPlacesFactor"`
+		ScalingFactor       int      `json:"scalingFactor"`
+		MarketModes         []string `json:"marketModes"`
+	}
+
+	MarketsResponse struct {
+		Markets []Market `json:"markets"`
+	}
+
+	// MarketNavigationResponse is a node of the market navigation tree: its
+	// child nodes and the markets directly under it.
+	MarketNavigationResponse struct {
+		Nodes   []MarketNavigationNode `json:"nodes"`
+		Markets []Market               `json:"markets"`
+	}
+
+	MarketNavigationNode struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	MarketDetailsListResponse struct {
+		MarketDetails []CapitalMarketDetailsResponse `json:"marketDetails"`
 	}
 
 	DealingRules struct {
 		MinDealSize             DealSize `json:"minDealSize"`
 		MaxDealSize             DealSize `json:"maxDealSize"`
+		MinSizeIncrement        DealSize `json:"minSizeIncrement"`
 		MinStopOrProfitDistance DealSize `json:"minStopOrProfitDistance"`
+		MaxStopOrProfitDistance DealSize `json:"maxStopOrProfitDistance"`
+
+		// MinGuaranteedStopDistance applies instead of MinStopOrProfitDistance
+		// to guaranteed stops, and LimitedRiskPremium is what they cost
+		MinGuaranteedStopDistance DealSize `json:"minGuaranteedStopDistance"`
+		LimitedRiskPremium        DealSize `json:"limitedRiskPremium"`
+
+		// MinStepDistance is the smallest step a trailing stop moves by
+		MinStepDistance         DealSize `json:"minStepDistance"`
+		TrailingStopsPreference string   `json:"trailingStopsPreference"`
+		MarketOrderPreference   string   `json:"marketOrderPreference"`
 	}
 
 	DealSize struct {
@@ -74,6 +344,8 @@ type (
 	}
 
 	Instrument struct {
+		Epic                     string  `json:"epic"`
+		Expiry                   string  `json:"expiry"`
 		Name                     string  `json:"name"`
 		Type                     string  `json:"type"`
 		MarketID                 string  `json:"marketId"`
@@ -84,6 +356,37 @@ type (
 		OtcTradeable             bool    `json:"otcTradeable"`
 		MarketStatus             string  `json:"marketStatus"`
 		StreamingPricesAvailable bool    `json:"streamingPricesAvailable"`
+
+		Symbol                string        `json:"symbol"`
+		LotSize               int           `json:"lotSize"`
+		Currency              string        `json:"currency"`
+		GuaranteedStopAllowed bool          `json:"guaranteedStopAllowed"`
+		MarginFactor          float64       `json:"marginFactor"`
+		MarginFactorUnit      string        `json:"marginFactorUnit"`
+		OpeningHours          *OpeningHours `json:"openingHours"`
+		OvernightFee          OvernightFee  `json:"overnightFee"`
+	}
+
+	// OpeningHours lists per weekday the trading sessions of an instrument,
+	// as "HH:MM - HH:MM" ranges in Zone.
+	OpeningHours struct {
+		Mon  []string `json:"mon"`
+		Tue  []string `json:"tue"`
+		Wed  []string `json:"wed"`
+		Thu  []string `json:"thu"`
+		Fri  []string `json:"fri"`
+		Sat  []string `json:"sat"`
+		Sun  []string `json:"sun"`
+		Zone string   `json:"zone"`
+	}
+
+	// OvernightFee holds the swap rates, in percent, charged on positions
+	// held past SwapChargeTimestamp, a Unix time in milliseconds.
+	OvernightFee struct {
+		LongRate            float64 `json:"longRate"`
+		ShortRate           float64 `json:"shortRate"`
+		SwapChargeTimestamp int64   `json:"swapChargeTimestamp"`
+		SwapChargeInterval  int     `json:"swapChargeInterval"`
 	}
 
 	CapitalSessionRequest struct {
@@ -92,6 +395,11 @@ type (
 		EncryptedPassword bool   `json:"encryptedPassword"`
 	}
 
+	EncryptionKeyResponse struct {
+		EncryptionKey string `json:"encryptionKey"`
+		TimeStamp     int64  `json:"timeStamp"`
+	}
+
 	CapitalAccountsResponse struct {
 		Accounts []CapitalAccount `json:"accounts"`
 	}
@@ -122,6 +430,23 @@ type (
 		Available  float64 `json:"available"`
 	}
 
+	AccountPreferences struct {
+		HedgingMode bool                `json:"hedgingMode"`
+		Leverages   map[string]Leverage `json:"leverages"`
+	}
+
+	Leverage struct {
+		Current   int   `json:"current"`
+		Available []int `json:"available"`
+	}
+
+	// UpdatePreferencesRequest changes only the fields that are set.
+	// Leverages maps an instrument type such as CURRENCIES to its leverage.
+	UpdatePreferencesRequest struct {
+		HedgingMode *bool          `json:"hedgingMode,omitempty"`
+		Leverages   map[string]int `json:"leverages,omitempty"`
+	}
+
 	SwitchAccountResponse struct {
 		TrailingStopsEnabled  bool `json:"trailingStopsEnabled"`
 		DealingEnabled        bool `json:"dealingEnabled"`
@@ -139,6 +464,11 @@ type (
 		StreamEndpoint string `json:"streamEndpoint"`
 	}
 
+	SessionInfo struct {
+		CurrentAccount
+		ActiveAccount CapitalAccount `json:"activeAccount"`
+	}
+
 	PositionsResponse struct {
 		Positions []PositionObj `json:"positions"`
 	}
@@ -162,6 +492,27 @@ type (
 		Level          float64 `json:"level"`
 		Currency       string  `json:"currency"`
 		GuaranteedStop bool    `json:"guaranteedStop"`
+		StopLevel      float64 `json:"stopLevel,omitempty"`
+		StopDistance   float64 `json:"stopDistance,omitempty"`
+		ProfitLevel    float64 `json:"profitLevel,omitempty"`
+		TrailingStop   bool    `json:"trailingStop"`
+		TrailingStep   float64 `json:"trailingStep,omitempty"`
+	}
+
+	// UpdatePositionRequest amends the stop and limit of an open position.
+	// Unset fields keep their current value; RemoveStop and RemoveProfit
+	// take the stop or limit off the position.
+	UpdatePositionRequest struct {
+		GuaranteedStop *bool    `json:"guaranteedStop,omitempty"`
+		TrailingStop   *bool    `json:"trailingStop,omitempty"`
+		StopLevel      *float64 `json:"stopLevel,omitempty"`
+		StopDistance   *float64 `json:"stopDistance,omitempty"`
+		StopAmount     *float64 `json:"stopAmount,omitempty"`
+		ProfitLevel    *float64 `json:"profitLevel,omitempty"`
+		ProfitDistance *float64 `json:"profitDistance,omitempty"`
+		ProfitAmount   *float64 `json:"profitAmount,omitempty"`
+		RemoveStop     bool     `json:"-"`
+		RemoveProfit   bool     `json:"-"`
 	}
 
 	Market struct {
@@ -213,3 +564,33 @@ type (
 		TrailingStopsEnabled  bool   `json:"trailingStopsEnabled"`
 	}
 )
+
+// MarshalJSON sends GoodTillDate in DateTimeLayout, in UTC, and leaves it
+// out when zero.
+func (r WorkingOrderRequest) MarshalJSON() ([]byte, error) {
+	type request WorkingOrderRequest
+	payload := struct {
+		request
+		GoodTillDate string `json:"goodTillDate,omitempty"`
+	}{request: request(r)}
+
+	if !r.GoodTillDate.IsZero() {
+		payload.GoodTillDate = r.GoodTillDate.UTC().Format(DateTimeLayout)
+	}
+
+	return json.Marshal(payload)
+}
+
+func (r UpdateWorkingOrderRequest) MarshalJSON() ([]byte, error) {
+	type request UpdateWorkingOrderRequest
+	payload := struct {
+		request
+		GoodTillDate string `json:"goodTillDate,omitempty"`
+	}{request: request(r)}
+
+	if r.GoodTillDate != nil && !r.GoodTillDate.IsZero() {
+		payload.GoodTillDate = r.GoodTillDate.UTC().Format(DateTimeLayout)
+	}
+
+	return json.Marshal(payload)
+}
@@ -0,0 +1,102 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// maxNavigationMarkets is the most markets one navigation node returns.
+const maxNavigationMarkets = 500
+
+// ErrCatalogTruncated is returned by BuildCatalog when a node lists as many
+// markets as one request returns, so that some may be missing.
+var ErrCatalogTruncated = errors.New("market navigation node may list more markets than returned")
+
+// GetMarketNavigation returns the node nodeID of the market navigation tree,
+// or the top-level categories when nodeID is empty.
+func (c *client) GetMarketNavigation(ctx context.Context, demo bool, nodeID string, cst, securityToken string) (*models.MarketNavigationResponse, error) {
+	endpoint := "/marketnavigation"
+	if nodeID != "" {
+		endpoint += "/" + url.PathEscape(nodeID) + "?limit=" + strconv.Itoa(maxNavigationMarkets)
+	}
+
+	data, _, err := c.request(ctx, "GET", demo, endpoint, nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting market navigation: %w", err)
+	}
+
+	var response models.MarketNavigationResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing market navigation response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// BuildCatalog walks the whole market navigation tree and lists every market
+// with the path of node names leading to it. A market listed under several
+// nodes appears once per path. A node listing the maximum number of markets
+// fails the crawl with ErrCatalogTruncated rather than returning a catalog
+// with markets missing. Requests go through the client's rate limits, so a
+// full crawl takes a while.
+func (c *client) BuildCatalog(ctx context.Context, demo bool, cst, securityToken string) (*Catalog, error) {
+	root, err := c.GetMarketNavigation(ctx, demo, "", cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{}
+	visited := make(map[string]bool)
+
+	var walk func(node models.MarketNavigationNode, path []string) error
+	walk = func(node models.MarketNavigationNode, path []string) error {
+		if visited[node.ID] {
+			return nil
+		}
+		visited[node.ID] = true
+
+		path = append(path[:len(path):len(path)], node.Name)
+
+		response, err := c.GetMarketNavigation(ctx, demo, node.ID, cst, securityToken)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", node.ID, err)
+		}
+
+		// The API does not page node markets, so a full page cannot be trusted
+		if len(response.Markets) >= maxNavigationMarkets {
+			return fmt.Errorf("%w: node %s", ErrCatalogTruncated, node.ID)
+		}
+
+		for _, market := range response.Markets {
+			catalog.Entries = append(catalog.Entries, CatalogEntry{
+				Epic:           market.Epic,
+				InstrumentName: market.InstrumentName,
+				InstrumentType: market.InstrumentType,
+				Path:           path,
+			})
+		}
+
+		for _, child := range response.Nodes {
+			if err := walk(child, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, node := range root.Nodes {
+		if err := walk(node, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	catalog.sort()
+
+	return catalog, nil
+}
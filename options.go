@@ -0,0 +1,111 @@
+package capital
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Option func(*client)
+
+// WithHTTPClient replaces the default HTTP client, whose timeout is DefaultTimeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *client) {
+		if httpClient != nil {
+			c.httpClient = httpClient
+		}
+	}
+}
+
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *client) {
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
+}
+
+// WithTimeout bounds every single HTTP attempt, on top of any deadline
+// carried by the caller's context. The wait for a rate limit slot is not
+// part of the attempt.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *client) {
+		c.timeout = timeout
+	}
+}
+
+func WithBaseURLs(baseUrl, demoBaseUrl string) Option {
+	return func(c *client) {
+		if baseUrl != "" {
+			c.baseURL = baseUrl
+		}
+		if demoBaseUrl != "" {
+			c.demoBaseURL = demoBaseUrl
+		}
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *client) {
+		c.userAgent = userAgent
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *client) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// WithAPIKey sets the API key CreateSession uses when called without one.
+func WithAPIKey(apiKey string) Option {
+	return func(c *client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithEncryptedPassword makes CreateSession RSA-encrypt the password with
+// the key from /session/encryptionKey instead of sending it in plaintext.
+func WithEncryptedPassword() Option {
+	return func(c *client) {
+		c.encryptPassword = true
+	}
+}
+
+// WithPreTradeChecks makes OpenPosition run CheckOrder against the current
+// market details and reject failing orders without sending them.
+func WithPreTradeChecks() Option {
+	return func(c *client) {
+		c.preTradeChecks = true
+	}
+}
+
+func WithRateLimits(limits RateLimits) Option {
+	return func(c *client) {
+		c.limiters = newRateLimiters(limits)
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *client) {
+		c.retryPolicy = policy
+	}
+}
+
+func WithConfirmPolicy(policy ConfirmPolicy) Option {
+	return func(c *client) {
+		c.confirmPolicy = policy
+	}
+}
+
+// WithOrderKeyRetention sets how long client order keys are remembered after
+// their submission. Resubmitting a key after that opens a new order.
+func WithOrderKeyRetention(retention time.Duration) Option {
+	return func(c *client) {
+		if retention > 0 {
+			c.orderKeyRetention = retention
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package capital
+
+import (
+	"capital/models"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidOrder = errors.New("invalid order")
+
+// Direction is shared with the models, so market and working orders are
+// validated the same way.
+type Direction = models.Direction
+
+const (
+	Buy  = models.DirectionBuy
+	Sell = models.DirectionSell
+)
+
+type ProtectionKind int
+
+const (
+	ProtectionLevel ProtectionKind = iota + 1
+	ProtectionDistance
+	ProtectionAmount
+)
+
+// Protection is a stop or profit target, given either as a price level, a
+// distance from the opening price or an amount in the account currency.
+type Protection struct {
+	Kind  ProtectionKind
+	Value float64
+}
+
+func AtLevel(level float64) *Protection {
+	return &Protection{Kind: ProtectionLevel, Value: level}
+}
+
+func AtDistance(distance float64) *Protection {
+	return &Protection{Kind: ProtectionDistance, Value: distance}
+}
+
+func ForAmount(amount float64) *Protection {
+	return &Protection{Kind: ProtectionAmount, Value: amount}
+}
+
+// OrderRequest describes a market order. A nil Stop or Profit means none.
+// Resubmitting an order with the same ClientOrderKey never opens a second
+// position: the client resolves the earlier submission first.
+type OrderRequest struct {
+	ClientOrderKey string
+	Epic           string
+	Direction      Direction
+	Size           float64
+	Stop           *Protection
+	Profit         *Protection
+	GuaranteedStop bool
+	TrailingStop   bool
+}
+
+// Validate checks the order for consistency and, when rules is not nil,
+// against the dealing rules returned by GetMarketDetails.
+func (o OrderRequest) Validate(rules *models.DealingRules) error {
+	if o.Epic == "" {
+		return fmt.Errorf("%w: epic is required", ErrInvalidOrder)
+	}
+
+	if !o.Direction.Valid() {
+		return fmt.Errorf("%w: direction %q", ErrInvalidOrder, o.Direction)
+	}
+
+	if o.Size <= 0 {
+		return fmt.Errorf("%w: size must be positive", ErrInvalidOrder)
+	}
+
+	if err := o.Stop.validate("stop"); err != nil {
+		return err
+	}
+
+	if err := o.Profit.validate("profit"); err != nil {
+		return err
+	}
+
+	if o.TrailingStop && (o.Stop == nil || o.Stop.Kind != ProtectionDistance || o.GuaranteedStop) {
+		return fmt.Errorf("%w: a trailing stop requires a stop distance and no guaranteed stop", ErrInvalidOrder)
+	}
+
+	if rules == nil {
+		return nil
+	}
+
+	if reason, detail := o.checkRules(rules, 0, o.Stop.distance(), o.Profit.distance()); reason != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidOrder, detail)
+	}
+
+	return nil
+}
+
+// checkRules checks the size and the stop and profit distances of the order
+// against the dealing rules, returning the reason of the first violation or
+// an empty reason. Distances are in points and zero when not known. Rules in
+// percent are only checked when the entry level is known.
+func (o OrderRequest) checkRules(rules *models.DealingRules, entry, stopDistance, profitDistance float64) (PreTradeReason, string) {
+	if rules.MinDealSize.Value > 0 && o.Size < rules.MinDealSize.Value {
+		return ReasonSizeTooSmall, fmt.Sprintf("size %v is below the minimum deal size %v", o.Size, rules.MinDealSize.Value)
+	}
+
+	if rules.MaxDealSize.Value > 0 && o.Size > rules.MaxDealSize.Value {
+		return ReasonSizeTooLarge, fmt.Sprintf("size %v is above the maximum deal size %v", o.Size, rules.MaxDealSize.Value)
+	}
+
+	minStop, minProfit, maxDistance := distanceLimits(rules, o.GuaranteedStop, entry)
+
+	if stopDistance > 0 && stopDistance < minStop {
+		return ReasonStopTooClose, fmt.Sprintf("stop distance %v is below the minimum %v", stopDistance, minStop)
+	}
+
+	if profitDistance > 0 && profitDistance < minProfit {
+		return ReasonProfitTooClose, fmt.Sprintf("profit distance %v is below the minimum %v", profitDistance, minProfit)
+	}
+
+	if maxDistance > 0 && stopDistance > maxDistance {
+		return ReasonStopTooFar, fmt.Sprintf("stop distance %v is above the maximum %v", stopDistance, maxDistance)
+	}
+
+	if maxDistance > 0 && profitDistance > maxDistance {
+		return ReasonProfitTooFar, fmt.Sprintf("profit distance %v is above the maximum %v", profitDistance, maxDistance)
+	}
+
+	return "", ""
+}
+
+// distanceLimits returns, in points, the minimum stop distance, the minimum
+// profit distance and the maximum distance of either. A guaranteed stop has
+// its own minimum.
+func distanceLimits(rules *models.DealingRules, guaranteed bool, entry float64) (float64, float64, float64) {
+	minProfit := ruleDistance(rules.MinStopOrProfitDistance, entry)
+
+	minStop := minProfit
+	if guaranteed && rules.MinGuaranteedStopDistance.Value > 0 {
+		minStop = ruleDistance(rules.MinGuaranteedStopDistance, entry)
+	}
+
+	return minStop, minProfit, ruleDistance(rules.MaxStopOrProfitDistance, entry)
+}
+
+// ruleDistance converts a distance rule to points, or to zero when it is in
+// percent and entry is not known.
+func ruleDistance(rule models.DealSize, entry float64) float64 {
+	if rule.Unit == "PERCENTAGE" {
+		return entry * rule.Value / 100
+	}
+
+	return rule.Value
+}
+
+// distance returns the distance in points of a protection given as one,
+// and zero otherwise.
+func (p *Protection) distance() float64 {
+	if p == nil || p.Kind != ProtectionDistance {
+		return 0
+	}
+
+	return p.Value
+}
+
+func (p *Protection) validate(name string) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.Kind < ProtectionLevel || p.Kind > ProtectionAmount {
+		return fmt.Errorf("%w: %s has no level, distance or amount", ErrInvalidOrder, name)
+	}
+
+	if p.Value <= 0 {
+		return fmt.Errorf("%w: %s value must be positive", ErrInvalidOrder, name)
+	}
+
+	return nil
+}
+
+func (p *Protection) apply(payload map[string]interface{}, prefix string) {
+	if p == nil {
+		return
+	}
+
+	switch p.Kind {
+	case ProtectionLevel:
+		payload[prefix+"Level"] = p.Value
+	case ProtectionDistance:
+		payload[prefix+"Distance"] = p.Value
+	case ProtectionAmount:
+		payload[prefix+"Amount"] = p.Value
+	}
+}
+
+func (o OrderRequest) payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"epic":           o.Epic,
+		"direction":      string(o.Direction),
+		"size":           o.Size,
+		"guaranteedStop": o.GuaranteedStop,
+	}
+
+	if o.TrailingStop {
+		payload["trailingStop"] = true
+	}
+
+	o.Stop.apply(payload, "stop")
+	o.Profit.apply(payload, "profit")
+
+	return payload
+}
@@ -0,0 +1,336 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// reconcileSkew extends the end of the history searched on reconciliation,
+// for clock skew between us and the server.
+const reconcileSkew = 5 * time.Second
+
+// DefaultOrderKeyRetention is how long client order keys are remembered.
+const DefaultOrderKeyRetention = 24 * time.Hour
+
+// orderFingerprint identifies what an order would look like once it exists
+// on the server, for orders whose deal reference we never received.
+type orderFingerprint struct {
+	activityType string
+	epic         string
+	direction    Direction
+	size         float64
+	level        float64
+}
+
+func (o OrderRequest) fingerprint() orderFingerprint {
+	return orderFingerprint{
+		activityType: models.ActivityTypePosition,
+		epic:         o.Epic,
+		direction:    o.Direction,
+		size:         o.Size,
+	}
+}
+
+func workingOrderFingerprint(order models.WorkingOrderRequest) orderFingerprint {
+	return orderFingerprint{
+		activityType: models.ActivityTypeWorkingOrder,
+		epic:         order.Epic,
+		direction:    order.Direction,
+		size:         order.Size,
+		level:        order.Level,
+	}
+}
+
+// orderKeyID scopes a client order key to the account it was used on, so the
+// same key on two accounts names two orders.
+type orderKeyID struct {
+	accountId string
+	key       string
+}
+
+// orderKeyEntry tracks one client order key. Without a deal reference the
+// outcome of the submission is unknown; without a deal ID it is unconfirmed.
+type orderKeyEntry struct {
+	fingerprint   orderFingerprint
+	submittedAt   time.Time
+	existing      map[string]bool
+	dealReference string
+	dealID        string
+}
+
+func (c *client) orderKey(key orderKeyID) (orderKeyEntry, bool) {
+	c.orderKeysMu.Lock()
+	defer c.orderKeysMu.Unlock()
+
+	entry, ok := c.orderKeys[key]
+	if !ok || time.Since(entry.submittedAt) > c.orderKeyRetention {
+		return orderKeyEntry{}, false
+	}
+
+	return *entry, true
+}
+
+func (c *client) updateOrderKey(key orderKeyID, fn func(*orderKeyEntry)) {
+	if key.key == "" {
+		return
+	}
+
+	c.orderKeysMu.Lock()
+	defer c.orderKeysMu.Unlock()
+
+	entry, ok := c.orderKeys[key]
+	if !ok {
+		entry = &orderKeyEntry{}
+		c.orderKeys[key] = entry
+	}
+	fn(entry)
+}
+
+func (c *client) forgetOrderKey(key orderKeyID) {
+	c.orderKeysMu.Lock()
+	delete(c.orderKeys, key)
+	c.orderKeysMu.Unlock()
+}
+
+// claimedDealIDs returns the deal IDs already attributed to an order key,
+// so reconciliation never hands the same deal to two keys.
+func (c *client) claimedDealIDs() map[string]bool {
+	c.orderKeysMu.Lock()
+	defer c.orderKeysMu.Unlock()
+
+	claimed := make(map[string]bool, len(c.orderKeys))
+	for _, entry := range c.orderKeys {
+		if entry.dealID != "" {
+			claimed[entry.dealID] = true
+		}
+	}
+
+	return claimed
+}
+
+// resumeOrderKey resolves an earlier submission under key. It reports the
+// deal ID and true when that submission produced a deal, and false when the
+// order has to be submitted (again).
+func (c *client) resumeOrderKey(ctx context.Context, demo bool, key orderKeyID, fingerprint orderFingerprint, cst, securityToken string) (string, bool, error) {
+	entry, ok := c.orderKey(key)
+	if !ok {
+		return "", false, nil
+	}
+
+	if entry.fingerprint != fingerprint {
+		return "", false, fmt.Errorf("%w: client order key %q was used for a different order", ErrInvalidOrder, key.key)
+	}
+
+	if entry.dealID != "" {
+		return entry.dealID, true, nil
+	}
+
+	if entry.dealReference != "" {
+		confirm, err := c.confirmDeal(ctx, demo, entry.dealReference, cst, securityToken)
+		if err != nil {
+			return "", false, fmt.Errorf("error confirming deal: %w", err)
+		}
+
+		if checkAccepted(confirm) != nil {
+			c.forgetOrderKey(key)
+			return "", false, nil
+		}
+
+		dealID := affectedDealID(confirm, models.AffectedDealOpened)
+		c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealID = dealID })
+		return dealID, true, nil
+	}
+
+	dealID, err := c.reconcileOrder(ctx, demo, fingerprint, entry.submittedAt, entry.existing, cst, securityToken)
+	if err != nil {
+		return "", false, fmt.Errorf("error reconciling client order key %q: %w", key.key, err)
+	}
+
+	if dealID == "" {
+		c.forgetOrderKey(key)
+		return "", false, nil
+	}
+
+	c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealID = dealID })
+	return dealID, true, nil
+}
+
+// beginOrderKey records a submission under key before it is sent, and
+// drops the keys submitted longer than the retention ago.
+func (c *client) beginOrderKey(key orderKeyID, fingerprint orderFingerprint, existing map[string]bool) {
+	c.expireOrderKeys(time.Now().Add(-c.orderKeyRetention))
+
+	c.updateOrderKey(key, func(e *orderKeyEntry) {
+		*e = orderKeyEntry{fingerprint: fingerprint, submittedAt: time.Now(), existing: existing}
+	})
+}
+
+func (c *client) expireOrderKeys(before time.Time) {
+	c.orderKeysMu.Lock()
+	defer c.orderKeysMu.Unlock()
+
+	for key, entry := range c.orderKeys {
+		if entry.submittedAt.Before(before) {
+			delete(c.orderKeys, key)
+		}
+	}
+}
+
+// failOrderKey drops key when the server definitely did not act on the
+// submission, and keeps it for reconciliation when the outcome is unknown.
+func (c *client) failOrderKey(key orderKeyID, err error) {
+	if key.key == "" {
+		return
+	}
+
+	if apiErr, ok := AsAPIError(err); ok && apiErr.StatusCode < http.StatusInternalServerError {
+		c.forgetOrderKey(key)
+	}
+}
+
+// existingDeals returns the deal IDs of the open positions, or of the
+// working orders, before an order is sent, so that reconciliation can tell
+// them apart from what the order created.
+func (c *client) existingDeals(ctx context.Context, demo bool, activityType, cst, securityToken string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+
+	if activityType == models.ActivityTypeWorkingOrder {
+		data, _, err := c.request(ctx, "GET", demo, "/workingorders", nil, cst, securityToken, "")
+		if err != nil {
+			return nil, fmt.Errorf("error getting working orders: %w", err)
+		}
+
+		var response models.WorkingOrdersResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, fmt.Errorf("error parsing working orders response: %w", err)
+		}
+
+		for _, o := range response.WorkingOrders {
+			existing[o.WorkingOrderData.DealId] = true
+		}
+
+		return existing, nil
+	}
+
+	positions, err := c.getPositions(ctx, demo, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range positions.Positions {
+		existing[p.Position.DealId] = true
+	}
+
+	return existing, nil
+}
+
+// reconcileOrder looks for a deal created by an order whose outcome is
+// unknown, first among the open positions or working orders and then in the
+// activity history since the order was sent, and returns its deal ID or an
+// empty string. Deals in existing were there before the order was sent.
+func (c *client) reconcileOrder(ctx context.Context, demo bool, fingerprint orderFingerprint, since time.Time, existing map[string]bool, cst, securityToken string) (string, error) {
+	since = since.UTC()
+
+	excluded := c.claimedDealIDs()
+	for dealID := range existing {
+		excluded[dealID] = true
+	}
+
+	var dealID string
+	var err error
+	if fingerprint.activityType == models.ActivityTypeWorkingOrder {
+		dealID, err = c.findWorkingOrder(ctx, demo, fingerprint, excluded, cst, securityToken)
+	} else {
+		dealID, err = c.findOpenedPosition(ctx, demo, fingerprint, excluded, cst, securityToken)
+	}
+	if err != nil || dealID != "" {
+		return dealID, err
+	}
+
+	// The deal may already be closed or filled, which only the history shows
+	activities, err := c.getActivityHistory(ctx, demo, since, time.Now().Add(reconcileSkew), cst, securityToken)
+	if err != nil {
+		return "", err
+	}
+
+	for _, activity := range activities {
+		if activity.Type != fingerprint.activityType || activity.Epic != fingerprint.epic || activity.Details == nil || excluded[activity.DealId] {
+			continue
+		}
+
+		if Direction(activity.Details.Direction) != fingerprint.direction || activity.Details.Size != fingerprint.size {
+			continue
+		}
+
+		if fingerprint.level != 0 && activity.Details.Level != fingerprint.level {
+			continue
+		}
+
+		if !createdSince(activity.DateUTC, since) {
+			continue
+		}
+
+		return activity.DealId, nil
+	}
+
+	return "", nil
+}
+
+// findOpenedPosition returns the deal ID of an open position matching the
+// fingerprint that is not excluded, or an empty string.
+func (c *client) findOpenedPosition(ctx context.Context, demo bool, fingerprint orderFingerprint, excluded map[string]bool, cst, securityToken string) (string, error) {
+	response, err := c.getPositions(ctx, demo, cst, securityToken)
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range response.Positions {
+		if p.Market.Epic != fingerprint.epic || Direction(p.Position.Direction) != fingerprint.direction || p.Position.Size != fingerprint.size {
+			continue
+		}
+
+		if excluded[p.Position.DealId] {
+			continue
+		}
+
+		return p.Position.DealId, nil
+	}
+
+	return "", nil
+}
+
+func (c *client) findWorkingOrder(ctx context.Context, demo bool, fingerprint orderFingerprint, excluded map[string]bool, cst, securityToken string) (string, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/workingorders", nil, cst, securityToken, "")
+	if err != nil {
+		return "", err
+	}
+
+	var response models.WorkingOrdersResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", fmt.Errorf("error parsing working orders response: %w", err)
+	}
+
+	for _, o := range response.WorkingOrders {
+		order := o.WorkingOrderData
+		if order.Epic != fingerprint.epic || order.Direction != fingerprint.direction || order.OrderSize != fingerprint.size || order.OrderLevel != fingerprint.level {
+			continue
+		}
+
+		if excluded[order.DealId] {
+			continue
+		}
+
+		return order.DealId, nil
+	}
+
+	return "", nil
+}
+
+func createdSince(dateUTC string, since time.Time) bool {
+	created, err := time.Parse(models.DateTimeLayout, dateUTC)
+	return err == nil && !created.Before(since)
+}
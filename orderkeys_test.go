@@ -0,0 +1,153 @@
+package capital
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOpenPositionClientOrderKeySubmitsOnce(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	c := broker.client()
+	ctx := context.Background()
+
+	order := OrderRequest{ClientOrderKey: "key-1", Epic: "EPIC", Direction: Buy, Size: 1}
+
+	first, err := c.OpenPosition(ctx, false, "A", order, "cst", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := c.OpenPosition(ctx, false, "A", order, "cst", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Fatalf("resubmission returned deal %s, want %s", second, first)
+	}
+
+	if posts := broker.postCount(); posts != 1 {
+		t.Fatalf("sent %d position posts, want 1", posts)
+	}
+}
+
+func TestOpenPositionClientOrderKeyRejectsDifferentOrder(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	c := broker.client()
+	ctx := context.Background()
+
+	order := OrderRequest{ClientOrderKey: "key-1", Epic: "EPIC", Direction: Buy, Size: 1}
+	if _, err := c.OpenPosition(ctx, false, "A", order, "cst", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	order.Size = 2
+	if _, err := c.OpenPosition(ctx, false, "A", order, "cst", "token"); err == nil {
+		t.Fatal("reusing a key for a different order succeeded")
+	}
+
+	if posts := broker.postCount(); posts != 1 {
+		t.Fatalf("sent %d position posts, want 1", posts)
+	}
+}
+
+// The same key on another account is another order.
+func TestOpenPositionClientOrderKeyPerAccount(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	c := broker.client()
+	ctx := context.Background()
+
+	order := OrderRequest{ClientOrderKey: "key-1", Epic: "EPIC", Direction: Buy, Size: 1}
+	for _, account := range []string{"A", "B"} {
+		if _, err := c.OpenPosition(ctx, false, account, order, "cst", "token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	positions := broker.opened()
+	if len(positions) != 2 {
+		t.Fatalf("opened %d positions, want 2", len(positions))
+	}
+
+	if positions[0].account != "A" || positions[1].account != "B" {
+		t.Fatalf("opened positions on %s and %s, want A and B", positions[0].account, positions[1].account)
+	}
+}
+
+// A post whose outcome is unknown is reconciled against the open positions
+// instead of being sent again.
+func TestOpenPositionReconcilesUnknownOutcome(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	broker.failPosts = 1
+	c := broker.client(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+
+	order := OrderRequest{ClientOrderKey: "key-1", Epic: "EPIC", Direction: Buy, Size: 1}
+	dealID, err := c.OpenPosition(context.Background(), false, "A", order, "cst", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dealID != "deal-1" {
+		t.Fatalf("got deal %s, want deal-1", dealID)
+	}
+
+	if posts := broker.postCount(); posts != 1 {
+		t.Fatalf("sent %d position posts, want 1", posts)
+	}
+}
+
+// A position that was already open before the post is not mistaken for the
+// one the post opened.
+func TestOpenPositionReconcileSkipsEarlierPositions(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	c := broker.client(WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	ctx := context.Background()
+
+	order := OrderRequest{Epic: "EPIC", Direction: Buy, Size: 1}
+	if _, err := c.OpenPosition(ctx, false, "A", order, "cst", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.mu.Lock()
+	broker.failPosts = 1
+	broker.mu.Unlock()
+
+	order.ClientOrderKey = "key-1"
+	dealID, err := c.OpenPosition(ctx, false, "A", order, "cst", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dealID != "deal-2" {
+		t.Fatalf("got deal %s, want deal-2", dealID)
+	}
+
+	if posts := broker.postCount(); posts != 2 {
+		t.Fatalf("sent %d position posts, want 2", posts)
+	}
+}
+
+func TestOrderKeysExpire(t *testing.T) {
+	broker := newFakeBroker(t, "A")
+	c := broker.client(WithOrderKeyRetention(time.Millisecond))
+	ctx := context.Background()
+
+	if _, err := c.OpenPosition(ctx, false, "A", OrderRequest{ClientOrderKey: "key-1", Epic: "EPIC", Direction: Buy, Size: 1}, "cst", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := c.OpenPosition(ctx, false, "A", OrderRequest{ClientOrderKey: "key-2", Epic: "EPIC", Direction: Buy, Size: 1}, "cst", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	impl := c.(*client)
+	impl.orderKeysMu.Lock()
+	defer impl.orderKeysMu.Unlock()
+
+	if _, ok := impl.orderKeys[orderKeyID{accountId: "A", key: "key-1"}]; ok {
+		t.Fatal("expired key was kept")
+	}
+}
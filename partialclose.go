@@ -0,0 +1,195 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrHedgingModeEnabled = errors.New("partial close is not possible while hedging mode is enabled")
+
+	// ErrAmbiguousReduction means the netting order could reduce, or did
+	// reduce, another position on the same epic.
+	ErrAmbiguousReduction = errors.New("partial close does not target the position alone")
+)
+
+// Reduction is how much of a position to close: a size, or a fraction of
+// the current size between 0 and 1.
+type Reduction struct {
+	Size     float64
+	Fraction float64
+}
+
+func BySize(size float64) Reduction {
+	return Reduction{Size: size}
+}
+
+func ByFraction(fraction float64) Reduction {
+	return Reduction{Fraction: fraction}
+}
+
+type PartialCloseResult struct {
+	Confirmation  *models.CapitalDealConfirmation
+	ClosedSize    float64
+	RemainingSize float64
+}
+
+// ReducePosition closes part of a position. Capital.com closes positions only
+// as a whole, so the reduction is an opposite order that nets against the
+// position, which requires hedging mode to be off and no other position to
+// be open on the epic, since the broker picks which position it nets
+// against. A reduction covering the whole position closes it.
+func (c *client) ReducePosition(ctx context.Context, demo bool, accountId, dealID string, reduction Reduction, cst, securityToken string) (*PartialCloseResult, error) {
+	if (reduction.Size > 0) == (reduction.Fraction > 0) {
+		return nil, fmt.Errorf("%w: exactly one of size or fraction must be positive", ErrInvalidOrder)
+	}
+
+	if reduction.Fraction > 1 {
+		return nil, fmt.Errorf("%w: fraction %v is above 1", ErrInvalidOrder, reduction.Fraction)
+	}
+
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	position, err := c.getPosition(ctx, demo, dealID, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := c.getMarketDetails(ctx, demo, position.Market.Epic, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	size := position.Position.Size
+	closeSize := reduction.Size
+	if reduction.Fraction > 0 {
+		closeSize = roundDownToIncrement(size*reduction.Fraction, details.DealingRules.MinSizeIncrement.Value)
+	}
+
+	if closeSize <= 0 || closeSize > size {
+		return nil, fmt.Errorf("%w: close size %v is not within the position size %v", ErrInvalidOrder, closeSize, size)
+	}
+
+	if closeSize == size {
+		confirm, err := c.closePosition(ctx, demo, dealID, cst, securityToken)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PartialCloseResult{Confirmation: confirm, ClosedSize: size}, nil
+	}
+
+	minSize := details.DealingRules.MinDealSize.Value
+	if closeSize < minSize {
+		return nil, fmt.Errorf("%w: close size %v is below the minimum deal size %v", ErrInvalidOrder, closeSize, minSize)
+	}
+
+	remaining := size - closeSize
+	if remaining < minSize {
+		return nil, fmt.Errorf("%w: remaining size %v is below the minimum deal size %v", ErrInvalidOrder, remaining, minSize)
+	}
+
+	preferences, err := c.getAccountPreferences(ctx, demo, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if preferences.HedgingMode {
+		return nil, ErrHedgingModeEnabled
+	}
+
+	positions, err := c.getPositions(ctx, demo, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range positions.Positions {
+		if p.Market.Epic == position.Market.Epic && p.Position.DealId != dealID {
+			return nil, fmt.Errorf("%w: %s has other open positions", ErrAmbiguousReduction, position.Market.Epic)
+		}
+	}
+
+	order := OrderRequest{
+		Epic:      position.Market.Epic,
+		Direction: Direction(position.Position.Direction).Opposite(),
+		Size:      closeSize,
+	}
+
+	// Not resubmitted on failure: a netted reduction leaves no new position
+	// to look for, so a resend could reduce the position twice
+	data, _, err := c.request(ctx, "POST", demo, "/positions", order.payload(), cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error reducing position: %w", err)
+	}
+
+	var response models.CapitalDealReference
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing position response: %w", err)
+	}
+
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
+	if err != nil {
+		return nil, fmt.Errorf("error confirming position reduction: %w", err)
+	}
+
+	if err := checkAccepted(confirm); err != nil {
+		return nil, fmt.Errorf("position reduction not accepted: %w", err)
+	}
+
+	status := reducedStatus(confirm, dealID)
+	if status == "" {
+		return nil, fmt.Errorf("%w: deal %s is not among the affected deals of %s", ErrAmbiguousReduction, dealID, confirm.DealReference)
+	}
+
+	result := &PartialCloseResult{Confirmation: confirm, ClosedSize: closeSize, RemainingSize: remaining}
+	if status == models.AffectedDealFullyClosed {
+		result.ClosedSize, result.RemainingSize = size, 0
+		return result, nil
+	}
+
+	// Report what the broker kept open rather than our own arithmetic; the
+	// reduction is done either way, so a failed lookup is not an error
+	reduced, err := c.getPosition(ctx, demo, dealID, cst, securityToken)
+	if err != nil {
+		c.logger.WarnContext(ctx, "could not read reduced position", "dealId", dealID, "error", err)
+		return result, nil
+	}
+	result.RemainingSize = reduced.Position.Size
+	result.ClosedSize = size - reduced.Position.Size
+
+	return result, nil
+}
+
+// reducedStatus returns how a reduction affected dealID, or an empty string
+// when it did not touch that deal.
+func reducedStatus(confirm *models.CapitalDealConfirmation, dealID string) string {
+	for _, deal := range confirm.AffectedDeals {
+		if deal.DealID == dealID && (deal.Status == models.AffectedDealPartiallyClosed || deal.Status == models.AffectedDealFullyClosed) {
+			return deal.Status
+		}
+	}
+
+	return ""
+}
+
+func roundDownToIncrement(size, increment float64) float64 {
+	if increment <= 0 {
+		return size
+	}
+
+	// The epsilon absorbs float error such as 0.3/0.1 = 2.9999999999999996
+	return math.Floor(size/increment+1e-9) * increment
+}
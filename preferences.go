@@ -0,0 +1,77 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+func (c *client) GetAccountPreferences(ctx context.Context, demo bool, accountId, cst, securityToken string) (*models.AccountPreferences, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getAccountPreferences(ctx, demo, cst, securityToken)
+}
+
+// UpdateAccountPreferences changes hedging mode and leverages of the account.
+// Leverages are checked against the values the account offers before
+// anything is sent.
+func (c *client) UpdateAccountPreferences(ctx context.Context, demo bool, accountId string, update models.UpdatePreferencesRequest, cst, securityToken string) (*models.AccountPreferences, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(update.Leverages) > 0 {
+		current, err := c.getAccountPreferences(ctx, demo, cst, securityToken)
+		if err != nil {
+			return nil, err
+		}
+
+		for instrumentType, leverage := range update.Leverages {
+			available, ok := current.Leverages[instrumentType]
+			if !ok {
+				return nil, fmt.Errorf("no leverage setting for instrument type %s", instrumentType)
+			}
+			if !slices.Contains(available.Available, leverage) {
+				return nil, fmt.Errorf("leverage %d is not available for %s, choose from %v", leverage, instrumentType, available.Available)
+			}
+		}
+	}
+
+	if _, _, err := c.request(ctx, "PUT", demo, "/accounts/preferences", update, cst, securityToken, ""); err != nil {
+		return nil, fmt.Errorf("error updating account preferences: %w", err)
+	}
+
+	return c.getAccountPreferences(ctx, demo, cst, securityToken)
+}
+
+func (c *client) getAccountPreferences(ctx context.Context, demo bool, cst, securityToken string) (*models.AccountPreferences, error) {
+	data, _, err := c.request(ctx, "GET", demo, "/accounts/preferences", nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting account preferences: %w", err)
+	}
+
+	var response models.AccountPreferences
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing account preferences response: %w", err)
+	}
+
+	return &response, nil
+}
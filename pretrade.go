@@ -0,0 +1,163 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrPreTradeRejected = errors.New("order rejected by pre-trade check")
+
+type PreTradeReason string
+
+const (
+	ReasonMarketClosed       PreTradeReason = "MARKET_CLOSED"
+	ReasonMarketEditsOnly    PreTradeReason = "MARKET_EDITS_ONLY"
+	ReasonMarketNotTradeable PreTradeReason = "MARKET_NOT_TRADEABLE"
+	ReasonNoPrice            PreTradeReason = "NO_PRICE"
+	ReasonSizeTooSmall       PreTradeReason = "SIZE_TOO_SMALL"
+	ReasonSizeTooLarge       PreTradeReason = "SIZE_TOO_LARGE"
+	ReasonStopWrongSide      PreTradeReason = "STOP_WRONG_SIDE"
+	ReasonStopTooClose       PreTradeReason = "STOP_TOO_CLOSE"
+	ReasonStopTooFar         PreTradeReason = "STOP_TOO_FAR"
+	ReasonProfitWrongSide    PreTradeReason = "PROFIT_WRONG_SIDE"
+	ReasonProfitTooClose     PreTradeReason = "PROFIT_TOO_CLOSE"
+	ReasonProfitTooFar       PreTradeReason = "PROFIT_TOO_FAR"
+)
+
+// PreTradeError explains why an order was rejected before being sent.
+// It matches ErrPreTradeRejected with errors.Is.
+type PreTradeError struct {
+	Reason PreTradeReason
+	Epic   string
+	Detail string
+}
+
+func (e *PreTradeError) Error() string {
+	return fmt.Sprintf("pre-trade check failed for %s: %s: %s", e.Epic, e.Reason, e.Detail)
+}
+
+func (e *PreTradeError) Is(target error) bool {
+	return target == ErrPreTradeRejected
+}
+
+// PreTradeReport describes an order against the current market. Distances
+// are in points from the entry level, which is the offer for a buy and the
+// bid for a sell. Stops and targets given as an amount have no level and
+// no distance. MinStopDistance is MinDistance unless a guaranteed stop has
+// a minimum of its own; a zero MaxDistance means no maximum.
+type PreTradeReport struct {
+	Epic            string
+	MarketStatus    string
+	Bid             float64
+	Offer           float64
+	EntryLevel      float64
+	MinDistance     float64
+	MinStopDistance float64
+	MaxDistance     float64
+	StopLevel       float64
+	StopDistance    float64
+	ProfitLevel     float64
+	ProfitDistance  float64
+}
+
+// CheckOrder runs the pre-trade checks for order against the market details
+// returned by GetMarketDetails, including the dealing rules Validate checks.
+// The report is returned even when a check fails.
+func CheckOrder(order OrderRequest, details *models.CapitalMarketDetailsResponse) (*PreTradeReport, error) {
+	if err := order.Validate(nil); err != nil {
+		return nil, err
+	}
+
+	status := details.Snapshot.MarketStatus
+	if status == "" {
+		status = details.Instrument.MarketStatus
+	}
+
+	report := &PreTradeReport{
+		Epic:         order.Epic,
+		MarketStatus: status,
+		Bid:          details.Snapshot.Bid,
+		Offer:        details.Snapshot.Offer,
+	}
+
+	reject := func(reason PreTradeReason, format string, args ...interface{}) (*PreTradeReport, error) {
+		return report, &PreTradeError{Reason: reason, Epic: order.Epic, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	switch status {
+	case models.MarketStatusTradeable:
+	case models.MarketStatusClosed:
+		return reject(ReasonMarketClosed, "market is closed")
+	case models.MarketStatusEditsOnly:
+		return reject(ReasonMarketEditsOnly, "market only accepts edits to existing positions")
+	default:
+		return reject(ReasonMarketNotTradeable, "market status is %q", status)
+	}
+
+	report.EntryLevel = report.Offer
+	if order.Direction == Sell {
+		report.EntryLevel = report.Bid
+	}
+
+	if report.EntryLevel <= 0 {
+		return reject(ReasonNoPrice, "no current %s price", order.Direction)
+	}
+
+	rules := &details.DealingRules
+	report.MinStopDistance, report.MinDistance, report.MaxDistance = distanceLimits(rules, order.GuaranteedStop, report.EntryLevel)
+
+	// A stop sits below the entry of a buy and above the entry of a sell,
+	// a profit target on the other side
+	stopSign := -1.0
+	if order.Direction == Sell {
+		stopSign = 1.0
+	}
+
+	if order.Stop != nil && order.Stop.Kind != ProtectionAmount {
+		report.StopLevel, report.StopDistance = protectionLevel(order.Stop, report.EntryLevel, stopSign)
+
+		if (report.StopLevel-report.EntryLevel)*stopSign <= 0 {
+			return reject(ReasonStopWrongSide, "stop level %v is on the wrong side of entry %v", report.StopLevel, report.EntryLevel)
+		}
+	}
+
+	if order.Profit != nil && order.Profit.Kind != ProtectionAmount {
+		report.ProfitLevel, report.ProfitDistance = protectionLevel(order.Profit, report.EntryLevel, -stopSign)
+
+		if (report.ProfitLevel-report.EntryLevel)*-stopSign <= 0 {
+			return reject(ReasonProfitWrongSide, "profit level %v is on the wrong side of entry %v", report.ProfitLevel, report.EntryLevel)
+		}
+	}
+
+	// The same dealing rules as Validate, now with the entry level known
+	if reason, detail := order.checkRules(rules, report.EntryLevel, report.StopDistance, report.ProfitDistance); reason != "" {
+		return reject(reason, "%s", detail)
+	}
+
+	return report, nil
+}
+
+// protectionLevel returns the level and the distance from entry of a stop or
+// profit target given as a level or a distance; sign is the side of entry
+// it belongs on.
+func protectionLevel(p *Protection, entry, sign float64) (float64, float64) {
+	if p.Kind == ProtectionDistance {
+		return entry + sign*p.Value, p.Value
+	}
+
+	return p.Value, math.Abs(p.Value - entry)
+}
+
+// PreTradeCheck fetches the market details for the order's epic and runs
+// CheckOrder against them.
+func (c *client) PreTradeCheck(ctx context.Context, demo bool, accountId string, order OrderRequest, cst, securityToken string) (*PreTradeReport, error) {
+	details, err := c.GetMarketDetails(ctx, demo, accountId, order.Epic, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return CheckOrder(order, details)
+}
@@ -0,0 +1,144 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPricesPerRequest is the most bars Capital.com returns for one request.
+const MaxPricesPerRequest = 1000
+
+type Resolution string
+
+const (
+	ResolutionMinute   Resolution = "MINUTE"
+	ResolutionMinute5  Resolution = "MINUTE_5"
+	ResolutionMinute15 Resolution = "MINUTE_15"
+	ResolutionMinute30 Resolution = "MINUTE_30"
+	ResolutionHour     Resolution = "HOUR"
+	ResolutionHour4    Resolution = "HOUR_4"
+	ResolutionDay      Resolution = "DAY"
+	ResolutionWeek     Resolution = "WEEK"
+)
+
+// Duration returns the length of one bar, or zero for an unknown resolution.
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionMinute5:
+		return 5 * time.Minute
+	case ResolutionMinute15:
+		return 15 * time.Minute
+	case ResolutionMinute30:
+		return 30 * time.Minute
+	case ResolutionHour:
+		return time.Hour
+	case ResolutionHour4:
+		return 4 * time.Hour
+	case ResolutionDay:
+		return 24 * time.Hour
+	case ResolutionWeek:
+		return 7 * 24 * time.Hour
+	}
+
+	return 0
+}
+
+type PriceQuery struct {
+	Resolution Resolution
+	From       time.Time
+	To         time.Time
+}
+
+// GetPrices returns the bars of epic between query.From and query.To in
+// ascending order. Ranges longer than MaxPricesPerRequest bars are fetched
+// page by page and merged without duplicates.
+func (c *client) GetPrices(ctx context.Context, demo bool, epic string, query PriceQuery, cst, securityToken string) ([]models.PriceBar, error) {
+	step := query.Resolution.Duration()
+	if step == 0 {
+		return nil, fmt.Errorf("unknown price resolution %q", query.Resolution)
+	}
+
+	if query.From.IsZero() || query.To.IsZero() || !query.From.Before(query.To) {
+		return nil, errors.New("price query needs a from time before its to time")
+	}
+
+	page := step * MaxPricesPerRequest
+	bars := make(map[time.Time]models.PriceBar)
+
+	for from := query.From; from.Before(query.To); from = from.Add(page) {
+		to := from.Add(page)
+		if to.After(query.To) {
+			to = query.To
+		}
+
+		chunk, err := c.getPricePage(ctx, demo, epic, query.Resolution, from, to, cst, securityToken)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, bar := range chunk {
+			bars[bar.Time] = bar
+		}
+	}
+
+	result := make([]models.PriceBar, 0, len(bars))
+	for _, bar := range bars {
+		result = append(result, bar)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+
+	return result, nil
+}
+
+// errorCodeNoPrices is the error code of a price range without any bars.
+// Other not-found errors, such as for an unknown epic, are real failures.
+const errorCodeNoPrices = "error.prices.not-found"
+
+func isNoPrices(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && strings.EqualFold(apiErr.ErrorCode, errorCodeNoPrices)
+}
+
+func (c *client) getPricePage(ctx context.Context, demo bool, epic string, resolution Resolution, from, to time.Time, cst, securityToken string) ([]models.PriceBar, error) {
+	query := url.Values{}
+	query.Set("resolution", string(resolution))
+	query.Set("max", strconv.Itoa(MaxPricesPerRequest))
+	query.Set("from", from.UTC().Format(models.DateTimeLayout))
+	query.Set("to", to.UTC().Format(models.DateTimeLayout))
+
+	data, _, err := c.request(ctx, "GET", demo, "/prices/"+url.PathEscape(epic)+"?"+query.Encode(), nil, cst, securityToken, "")
+	if err != nil {
+		// A page without any bars, such as a weekend, is reported as not found
+		if isNoPrices(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting prices: %w", err)
+	}
+
+	var response models.PricesResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing prices response: %w", err)
+	}
+
+	for i := range response.Prices {
+		t, err := time.Parse(models.DateTimeLayout, response.Prices[i].SnapshotTimeUTC)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing price time %q: %w", response.Prices[i].SnapshotTimeUTC, err)
+		}
+		response.Prices[i].Time = t
+	}
+
+	return response.Prices, nil
+}
@@ -0,0 +1,54 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A page without bars is skipped, while an unknown epic is an error.
+func TestGetPricesNotFound(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prices/EPIC" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"error.not-found.epic"}`))
+			return
+		}
+
+		if r.URL.Query().Get("from") != start.Format(models.DateTimeLayout) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"error.prices.not-found"}`))
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.PricesResponse{
+			Prices: []models.PriceBar{{SnapshotTimeUTC: start.Format(models.DateTimeLayout)}},
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL, server.URL, WithRateLimits(RateLimits{}))
+	ctx := context.Background()
+
+	// Two pages, the second of which has no bars
+	query := PriceQuery{Resolution: ResolutionMinute, From: start, To: start.Add(1500 * time.Minute)}
+
+	bars, err := c.GetPrices(ctx, false, "EPIC", query, "cst", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bars) != 1 || !bars[0].Time.Equal(start) {
+		t.Fatalf("got bars %+v, want one at %s", bars, start)
+	}
+
+	if _, err := c.GetPrices(ctx, false, "UNKNOWN", query, "cst", "token"); !IsNotFound(err) {
+		t.Fatalf("got error %v for an unknown epic, want not found", err)
+	}
+}
@@ -0,0 +1,133 @@
+package capital
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows Requests requests per Interval. A zero value disables it.
+type RateLimit struct {
+	Requests int
+	Interval time.Duration
+}
+
+// RateLimits configures one bucket per endpoint class. Trading covers
+// requests that create, amend or delete positions and working orders.
+type RateLimits struct {
+	Session       RateLimit
+	Trading       RateLimit
+	General       RateLimit
+	DemoPositions RateLimit
+}
+
+// DefaultRateLimits mirrors the quotas documented by Capital.com.
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Session:       RateLimit{Requests: 1, Interval: time.Second},
+		Trading:       RateLimit{Requests: 1, Interval: 100 * time.Millisecond},
+		General:       RateLimit{Requests: 10, Interval: time.Second},
+		DemoPositions: RateLimit{Requests: 1000, Interval: time.Hour},
+	}
+}
+
+type rateLimiters struct {
+	session       *rateLimiter
+	trading       *rateLimiter
+	general       *rateLimiter
+	demoPositions *rateLimiter
+}
+
+func newRateLimiters(limits RateLimits) *rateLimiters {
+	return &rateLimiters{
+		session:       newRateLimiter(limits.Session),
+		trading:       newRateLimiter(limits.Trading),
+		general:       newRateLimiter(limits.General),
+		demoPositions: newRateLimiter(limits.DemoPositions),
+	}
+}
+
+// wait blocks until every bucket that applies to the request has capacity.
+func (r *rateLimiters) wait(ctx context.Context, method string, demo bool, endpoint string) error {
+	path, _, _ := strings.Cut(endpoint, "?")
+
+	switch {
+	case method == "POST" && path == "/session":
+		return r.session.wait(ctx)
+	case method != "GET" && (strings.HasPrefix(path, "/positions") || strings.HasPrefix(path, "/workingorders")):
+		if demo && method == "POST" && path == "/positions" {
+			if err := r.demoPositions.wait(ctx); err != nil {
+				return err
+			}
+		}
+		return r.trading.wait(ctx)
+	default:
+		return r.general.wait(ctx)
+	}
+}
+
+// rateLimiter is a token bucket holding up to limit.Requests tokens that
+// refills one token every limit.Interval/limit.Requests.
+type rateLimiter struct {
+	mu     sync.Mutex
+	every  time.Duration
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Requests <= 0 || limit.Interval <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		every:  limit.Interval / time.Duration(limit.Requests),
+		burst:  float64(limit.Requests),
+		tokens: float64(limit.Requests),
+		last:   time.Now(),
+	}
+}
+
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns zero, or returns how long to wait until
+// one becomes available.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.every)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) * float64(l.every))
+}
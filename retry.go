@@ -0,0 +1,123 @@
+package capital
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how transient failures are retried. MaxAttempts
+// counts the first attempt, so 1 disables retries.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   250 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the given retry using exponential backoff
+// with jitter. A Retry-After sent by the server takes precedence when longer.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+
+	if apiErr, ok := AsAPIError(err); ok && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+	}
+
+	return delay
+}
+
+func (p RetryPolicy) wait(ctx context.Context, attempt int, err error) error {
+	timer := time.NewTimer(p.backoff(attempt, err))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// shouldRetry reports whether a failed request may be sent again. A rate
+// limited request was never processed, so it is safe for any method; other
+// transient failures are only retried for idempotent reads.
+func shouldRetry(ctx context.Context, method string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if IsRateLimited(err) {
+		return true
+	}
+
+	return method == "GET" && isTransient(ctx, err)
+}
+
+// isTransient reports whether err is a server or connection failure whose
+// outcome is unknown and which may succeed when tried again. Timeouts of a
+// single attempt count as transient; only the caller's ctx ending does not.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.StatusCode >= http.StatusInternalServerError || IsRateLimited(apiErr)
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
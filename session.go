@@ -0,0 +1,567 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"sync"
+	"time"
+)
+
+// Capital.com drops a session after 10 minutes without requests. KeepAlive
+// lets the default interval pass at most, leaving a comfortable margin.
+const DefaultKeepAliveInterval = 5 * time.Minute
+
+// Session owns the CST/X-SECURITY-TOKEN pair for one set of credentials.
+// It logs in lazily, logs in again when the server reports the session as
+// expired and retries the failed call once.
+type Session struct {
+	client     Client
+	demo       bool
+	apiKey     string
+	identifier string
+	password   string
+
+	mu       sync.RWMutex
+	tokens   *models.SessionTokens
+	info     *models.CreateSessionResponse
+	lastUsed time.Time
+
+	loginMu sync.Mutex
+}
+
+func NewSession(client Client, demo bool, apiKey, identifier, password string) *Session {
+	return &Session{
+		client:     client,
+		demo:       demo,
+		apiKey:     apiKey,
+		identifier: identifier,
+		password:   password,
+	}
+}
+
+func (s *Session) Login(ctx context.Context) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	return s.login(ctx)
+}
+
+// Tokens returns the current session tokens, or nil before the first login.
+func (s *Session) Tokens() *models.SessionTokens {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.tokens == nil {
+		return nil
+	}
+	tokens := *s.tokens
+	return &tokens
+}
+
+// Info returns the response of the most recent login.
+func (s *Session) Info() *models.CreateSessionResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.info
+}
+
+// KeepAlive pings the API whenever the session has been idle for half of
+// interval, so it never goes much longer than interval without a request.
+// It blocks until ctx is done. Pings never log in: while the session is
+// logged out or expired, KeepAlive waits for the next call to log in again.
+func (s *Session) KeepAlive(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultKeepAliveInterval
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			s.mu.RLock()
+			idle := time.Since(s.lastUsed)
+			s.mu.RUnlock()
+
+			if idle >= interval/2 {
+				s.keepAlive(ctx)
+			}
+		}
+	}
+}
+
+// keepAlive pings with the current tokens, if any. Failed pings are retried
+// on the next tick.
+func (s *Session) keepAlive(ctx context.Context) {
+	tokens := s.Tokens()
+	if tokens == nil {
+		return
+	}
+
+	if err := s.client.Ping(ctx, s.demo, tokens.CST, tokens.SecurityToken); err == nil {
+		s.touch()
+	}
+}
+
+func (s *Session) Ping(ctx context.Context) error {
+	return s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		return s.client.Ping(ctx, s.demo, tokens.CST, tokens.SecurityToken)
+	})
+}
+
+// Logout ends the session on the server. The next call logs in again.
+func (s *Session) Logout(ctx context.Context) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	tokens := s.Tokens()
+	if tokens == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.tokens = nil
+	s.info = nil
+	s.mu.Unlock()
+
+	return s.client.Logout(ctx, s.demo, tokens.CST, tokens.SecurityToken)
+}
+
+func (s *Session) GetSessionInfo(ctx context.Context) (*models.SessionInfo, error) {
+	var info *models.SessionInfo
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		info, err = s.client.GetSessionInfo(ctx, s.demo, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return info, err
+}
+
+func (s *Session) OpenPosition(ctx context.Context, accountId string, order OrderRequest) (string, error) {
+	var dealID string
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		dealID, err = s.client.OpenPosition(ctx, s.demo, accountId, order, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return dealID, err
+}
+
+func (s *Session) PreTradeCheck(ctx context.Context, accountId string, order OrderRequest) (*PreTradeReport, error) {
+	var report *PreTradeReport
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		report, err = s.client.PreTradeCheck(ctx, s.demo, accountId, order, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return report, err
+}
+
+func (s *Session) ClosePosition(ctx context.Context, accountId, dealID string) (*models.CapitalDealConfirmation, error) {
+	var confirm *models.CapitalDealConfirmation
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		confirm, err = s.client.ClosePosition(ctx, s.demo, accountId, dealID, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return confirm, err
+}
+
+func (s *Session) CloseAll(ctx context.Context, accountId string, filter CloseFilter) (*CloseAllReport, error) {
+	var report *CloseAllReport
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		report, err = s.client.CloseAll(ctx, s.demo, accountId, filter, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return report, err
+}
+
+func (s *Session) ReducePosition(ctx context.Context, accountId, dealID string, reduction Reduction) (*PartialCloseResult, error) {
+	var result *PartialCloseResult
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		result, err = s.client.ReducePosition(ctx, s.demo, accountId, dealID, reduction, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return result, err
+}
+
+func (s *Session) UpdatePosition(ctx context.Context, accountId, dealID string, update models.UpdatePositionRequest) (*models.PositionObj, error) {
+	var position *models.PositionObj
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		position, err = s.client.UpdatePosition(ctx, s.demo, accountId, dealID, update, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return position, err
+}
+
+func (s *Session) ConfirmDeal(ctx context.Context, accountId, dealReference string) (*models.CapitalDealConfirmation, error) {
+	var confirm *models.CapitalDealConfirmation
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		confirm, err = s.client.ConfirmDeal(ctx, s.demo, accountId, dealReference, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return confirm, err
+}
+
+func (s *Session) GetPositions(ctx context.Context, accountId string) (*models.PositionsResponse, error) {
+	var positions *models.PositionsResponse
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		positions, err = s.client.GetPositions(ctx, s.demo, accountId, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return positions, err
+}
+
+func (s *Session) GetMarketDetails(ctx context.Context, accountId, epic string) (*models.CapitalMarketDetailsResponse, error) {
+	var details *models.CapitalMarketDetailsResponse
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		details, err = s.client.GetMarketDetails(ctx, s.demo, accountId, epic, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return details, err
+}
+
+func (s *Session) CreateWorkingOrder(ctx context.Context, accountId string, order models.WorkingOrderRequest) (string, error) {
+	var dealID string
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		dealID, err = s.client.CreateWorkingOrder(ctx, s.demo, accountId, order, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return dealID, err
+}
+
+func (s *Session) GetWorkingOrders(ctx context.Context, accountId string) (*models.WorkingOrdersResponse, error) {
+	var orders *models.WorkingOrdersResponse
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		orders, err = s.client.GetWorkingOrders(ctx, s.demo, accountId, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return orders, err
+}
+
+func (s *Session) UpdateWorkingOrder(ctx context.Context, accountId, dealID string, update models.UpdateWorkingOrderRequest) (*models.CapitalDealConfirmation, error) {
+	var confirm *models.CapitalDealConfirmation
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		confirm, err = s.client.UpdateWorkingOrder(ctx, s.demo, accountId, dealID, update, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return confirm, err
+}
+
+func (s *Session) DeleteWorkingOrder(ctx context.Context, accountId, dealID string) (*models.CapitalDealConfirmation, error) {
+	var confirm *models.CapitalDealConfirmation
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		confirm, err = s.client.DeleteWorkingOrder(ctx, s.demo, accountId, dealID, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return confirm, err
+}
+
+func (s *Session) GetActivityHistory(ctx context.Context, accountId string, from, to time.Time) ([]models.Activity, error) {
+	var activities []models.Activity
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		activities, err = s.client.GetActivityHistory(ctx, s.demo, accountId, from, to, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return activities, err
+}
+
+func (s *Session) SearchMarkets(ctx context.Context, term string) ([]models.Market, error) {
+	var markets []models.Market
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		markets, err = s.client.SearchMarkets(ctx, s.demo, term, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return markets, err
+}
+
+func (s *Session) GetMarketSnapshots(ctx context.Context, epics []string) ([]models.CapitalMarket, error) {
+	var snapshots []models.CapitalMarket
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		snapshots, err = s.client.GetMarketSnapshots(ctx, s.demo, epics, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return snapshots, err
+}
+
+func (s *Session) GetMarketNavigation(ctx context.Context, nodeID string) (*models.MarketNavigationResponse, error) {
+	var navigation *models.MarketNavigationResponse
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		navigation, err = s.client.GetMarketNavigation(ctx, s.demo, nodeID, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return navigation, err
+}
+
+func (s *Session) BuildCatalog(ctx context.Context) (*Catalog, error) {
+	var catalog *Catalog
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		catalog, err = s.client.BuildCatalog(ctx, s.demo, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return catalog, err
+}
+
+func (s *Session) GetTradingHours(ctx context.Context, epic string) (*TradingHours, error) {
+	var hours *TradingHours
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		hours, err = s.client.GetTradingHours(ctx, s.demo, epic, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return hours, err
+}
+
+func (s *Session) GetPrices(ctx context.Context, epic string, query PriceQuery) ([]models.PriceBar, error) {
+	var bars []models.PriceBar
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		bars, err = s.client.GetPrices(ctx, s.demo, epic, query, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return bars, err
+}
+
+func (s *Session) GetAccounts(ctx context.Context) ([]models.CapitalAccount, error) {
+	var accounts []models.CapitalAccount
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		accounts, err = s.client.GetAccounts(ctx, s.demo, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return accounts, err
+}
+
+func (s *Session) GetAccountPreferences(ctx context.Context, accountId string) (*models.AccountPreferences, error) {
+	var preferences *models.AccountPreferences
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		preferences, err = s.client.GetAccountPreferences(ctx, s.demo, accountId, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return preferences, err
+}
+
+func (s *Session) UpdateAccountPreferences(ctx context.Context, accountId string, update models.UpdatePreferencesRequest) (*models.AccountPreferences, error) {
+	var preferences *models.AccountPreferences
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		preferences, err = s.client.UpdateAccountPreferences(ctx, s.demo, accountId, update, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return preferences, err
+}
+
+func (s *Session) SwitchActiveAccount(ctx context.Context, accountId string) (*models.SwitchAccountResponse, error) {
+	var response *models.SwitchAccountResponse
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		response, _, err = s.client.SwitchActiveAccount(ctx, s.demo, accountId, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return response, err
+}
+
+func (s *Session) GetCurrentAccount(ctx context.Context) (*models.CurrentAccount, error) {
+	var account *models.CurrentAccount
+	err := s.do(ctx, func(ctx context.Context, tokens models.SessionTokens) error {
+		var err error
+		account, err = s.client.GetCurrentAccount(ctx, s.demo, tokens.CST, tokens.SecurityToken)
+		return err
+	})
+
+	return account, err
+}
+
+// do runs fn with the current tokens. When the server rejects the session,
+// it logs in again and retries fn once with the fresh tokens, unless fn had
+// already submitted an order: the order may have gone through, so retrying
+// could place it twice and the error is returned instead.
+func (s *Session) do(ctx context.Context, fn func(ctx context.Context, tokens models.SessionTokens) error) error {
+	tokens, err := s.currentTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	submitted := false
+	ctx = withTokenObserver(ctx, s.updateTokens)
+	ctx = withSubmitObserver(ctx, func() { submitted = true })
+
+	err = fn(ctx, tokens)
+	if err == nil || !IsSessionExpired(err) || submitted {
+		s.touch()
+		return err
+	}
+
+	if err := s.relogin(ctx, tokens); err != nil {
+		return err
+	}
+
+	tokens, err = s.currentTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx, tokens)
+	s.touch()
+
+	return err
+}
+
+func (s *Session) currentTokens(ctx context.Context) (models.SessionTokens, error) {
+	if tokens := s.Tokens(); tokens != nil {
+		return *tokens, nil
+	}
+
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	// Another caller may have logged in while we waited for the lock
+	if tokens := s.Tokens(); tokens != nil {
+		return *tokens, nil
+	}
+
+	if err := s.login(ctx); err != nil {
+		return models.SessionTokens{}, err
+	}
+
+	return *s.Tokens(), nil
+}
+
+// relogin replaces stale tokens, unless a concurrent caller already did.
+func (s *Session) relogin(ctx context.Context, stale models.SessionTokens) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	if tokens := s.Tokens(); tokens != nil && tokens.CST != stale.CST {
+		return nil
+	}
+
+	return s.login(ctx)
+}
+
+func (s *Session) login(ctx context.Context) error {
+	info, tokens, err := s.client.CreateSession(ctx, s.demo, s.apiKey, s.identifier, s.password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.tokens
+	s.tokens = tokens
+	s.info = info
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+
+	// Nothing uses the replaced session any more
+	if c, ok := s.client.(sessionStates); ok && old != nil && old.CST != tokens.CST {
+		c.forgetSession(old.CST)
+	}
+
+	return nil
+}
+
+func (s *Session) updateTokens(tokens *models.SessionTokens) {
+	if tokens == nil || tokens.CST == "" || tokens.SecurityToken == "" {
+		return
+	}
+
+	s.mu.Lock()
+	var old string
+	if s.tokens != nil {
+		old = s.tokens.CST
+	}
+	updated := *tokens
+	s.tokens = &updated
+	s.mu.Unlock()
+
+	// The new CST already shares the state of the old one
+	if c, ok := s.client.(sessionStates); ok && old != "" && old != tokens.CST {
+		c.unaliasSession(old)
+	}
+}
+
+// sessionStates is implemented by clients that keep state per CST, which a
+// Session releases when it replaces its tokens.
+type sessionStates interface {
+	unaliasSession(cst string)
+	forgetSession(cst string)
+}
+
+func (s *Session) touch() {
+	s.mu.Lock()
+	s.lastUsed = time.Now()
+	s.mu.Unlock()
+}
+
+type tokenObserverKey struct{}
+
+// withTokenObserver lets the client report tokens handed out mid-call, such
+// as after an account switch, back to whoever owns them.
+func withTokenObserver(ctx context.Context, fn func(*models.SessionTokens)) context.Context {
+	return context.WithValue(ctx, tokenObserverKey{}, fn)
+}
+
+func notifyTokens(ctx context.Context, tokens *models.SessionTokens) {
+	if fn, ok := ctx.Value(tokenObserverKey{}).(func(*models.SessionTokens)); ok {
+		fn(tokens)
+	}
+}
+
+type submitObserverKey struct{}
+
+// withSubmitObserver lets the client report that it sent a request which
+// places an order, after which the call must not be replayed blindly.
+func withSubmitObserver(ctx context.Context, fn func()) context.Context {
+	return context.WithValue(ctx, submitObserverKey{}, fn)
+}
+
+func notifySubmitted(ctx context.Context) {
+	if fn, ok := ctx.Value(submitObserverKey{}).(func()); ok {
+		fn()
+	}
+}
@@ -0,0 +1,54 @@
+package capital
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Logging in again releases what the client kept for the replaced session.
+func TestSessionLoginForgetsReplacedSession(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		mu.Lock()
+		logins++
+		cst := fmt.Sprintf("cst-%d", logins)
+		mu.Unlock()
+
+		w.Header().Set("CST", cst)
+		w.Header().Set("X-SECURITY-TOKEN", "token")
+		w.Write([]byte(`{"currentAccountId":"A"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, server.URL, WithRateLimits(RateLimits{}))
+	s := NewSession(c, false, "api-key", "user@example.com", "secret")
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := s.Login(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	impl := c.(*client)
+	impl.sessionsMu.Lock()
+	defer impl.sessionsMu.Unlock()
+
+	if _, ok := impl.sessions["cst-1"]; ok {
+		t.Fatal("state of the replaced session was kept")
+	}
+
+	if _, ok := impl.sessions["cst-2"]; !ok {
+		t.Fatal("state of the current session is missing")
+	}
+}
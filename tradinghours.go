@@ -0,0 +1,224 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TradingHours answers when a market is open, from the weekly opening hours
+// in its market details. Sessions ending at or before their start run past
+// midnight into the next day.
+type TradingHours struct {
+	location *time.Location
+
+	// days holds the sessions of each weekday, indexed by time.Weekday
+	days [7][]tradingSession
+}
+
+type tradingSession struct {
+	start, end time.Duration
+}
+
+type tradingInterval struct {
+	start, end time.Time
+}
+
+// NewTradingHours parses opening hours. Ranges such as "00:00 - 21:59"
+// include their last minute, so that one closes at 22:00; an end of "00:00"
+// means midnight. Hours in a zone the system does not know are read with the
+// account's timezoneOffset, in hours from UTC.
+func NewTradingHours(hours *models.OpeningHours, timezoneOffset int) (*TradingHours, error) {
+	if hours == nil {
+		return nil, errors.New("market details have no opening hours")
+	}
+
+	th := &TradingHours{location: tradingLocation(hours.Zone, timezoneOffset)}
+
+	days := map[time.Weekday][]string{
+		time.Monday:    hours.Mon,
+		time.Tuesday:   hours.Tue,
+		time.Wednesday: hours.Wed,
+		time.Thursday:  hours.Thu,
+		time.Friday:    hours.Fri,
+		time.Saturday:  hours.Sat,
+		time.Sunday:    hours.Sun,
+	}
+
+	for day, ranges := range days {
+		for _, r := range ranges {
+			session, err := parseTradingSession(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s opening hours: %w", day, err)
+			}
+			th.days[day] = append(th.days[day], session)
+		}
+	}
+
+	return th, nil
+}
+
+func tradingLocation(zone string, timezoneOffset int) *time.Location {
+	if zone == "" || strings.EqualFold(zone, "UTC") {
+		return time.UTC
+	}
+
+	if location, err := time.LoadLocation(zone); err == nil {
+		return location
+	}
+
+	return time.FixedZone(zone, timezoneOffset*int(time.Hour/time.Second))
+}
+
+func parseTradingSession(r string) (tradingSession, error) {
+	parts := strings.Split(r, "-")
+	if len(parts) != 2 {
+		return tradingSession{}, fmt.Errorf("invalid range %q", r)
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return tradingSession{}, fmt.Errorf("invalid range %q: %w", r, err)
+	}
+
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return tradingSession{}, fmt.Errorf("invalid range %q: %w", r, err)
+	}
+
+	if end == 0 {
+		end = 24 * time.Hour
+	} else {
+		end += time.Minute
+	}
+
+	if end <= start {
+		end += 24 * time.Hour
+	}
+
+	return tradingSession{start: start, end: end}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// intervals returns the sessions overlapping the week after t, starting the
+// day before it for sessions that run past midnight. Back-to-back sessions,
+// such as a day ending at midnight and the next starting then, are merged.
+func (th *TradingHours) intervals(t time.Time) []tradingInterval {
+	local := t.In(th.location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, th.location)
+
+	var intervals []tradingInterval
+	for i := -1; i <= 8; i++ {
+		date := day.AddDate(0, 0, i)
+		for _, session := range th.days[date.Weekday()] {
+			intervals = append(intervals, tradingInterval{
+				start: clockTime(date, session.start),
+				end:   clockTime(date, session.end),
+			})
+		}
+	}
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start.Before(intervals[j].start)
+	})
+
+	var merged []tradingInterval
+	for _, interval := range intervals {
+		if n := len(merged); n > 0 && !interval.start.After(merged[n-1].end) {
+			if interval.end.After(merged[n-1].end) {
+				merged[n-1].end = interval.end
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+
+	return merged
+}
+
+// clockTime returns the wall clock time offset after midnight of date, so
+// that sessions keep their local hours across daylight saving changes.
+func clockTime(date time.Time, offset time.Duration) time.Time {
+	minutes := int(offset / time.Minute)
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, minutes, 0, 0, date.Location())
+}
+
+func (th *TradingHours) IsOpen(t time.Time) bool {
+	for _, interval := range th.intervals(t) {
+		if !t.Before(interval.start) && t.Before(interval.end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextOpen returns the start of the first session after t. When the market
+// is open at t, that is the session after the current one. It reports false
+// when the market has no sessions at all.
+func (th *TradingHours) NextOpen(t time.Time) (time.Time, bool) {
+	for _, interval := range th.intervals(t) {
+		if interval.start.After(t) {
+			return interval.start, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// NextClose returns the end of the session open at t or, when the market is
+// closed, of the next one. It reports false when the market has no sessions
+// at all or never closes.
+func (th *TradingHours) NextClose(t time.Time) (time.Time, bool) {
+	intervals := th.intervals(t)
+	for i, interval := range intervals {
+		if interval.end.After(t) {
+			// A session reaching the end of the window may continue past it
+			if i == len(intervals)-1 && !interval.start.After(t) {
+				return time.Time{}, false
+			}
+			return interval.end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// GetTradingHours returns the trading hours of epic. The account's timezone
+// offset is only looked up when the hours are not given in a known zone.
+func (c *client) GetTradingHours(ctx context.Context, demo bool, epic string, cst, securityToken string) (*TradingHours, error) {
+	details, err := c.getMarketDetails(ctx, demo, epic, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := details.Instrument.OpeningHours
+	if hours == nil {
+		return nil, fmt.Errorf("no opening hours for %s", epic)
+	}
+
+	offset := 0
+	if hours.Zone != "" && !strings.EqualFold(hours.Zone, "UTC") {
+		if _, err := time.LoadLocation(hours.Zone); err != nil {
+			account, err := c.GetCurrentAccount(ctx, demo, cst, securityToken)
+			if err != nil {
+				return nil, fmt.Errorf("error getting current account: %w", err)
+			}
+			offset = account.TimezoneOffset
+		}
+	}
+
+	return NewTradingHours(hours, offset)
+}
@@ -0,0 +1,163 @@
+package capital
+
+import (
+	"capital/models"
+	"testing"
+	"time"
+
+	// The DST cases must not depend on the zone database of the host
+	_ "time/tzdata"
+)
+
+func TestTradingHours(t *testing.T) {
+	allDay := []string{"00:00 - 00:00"}
+	weekdays := func(r string) models.OpeningHours {
+		return models.OpeningHours{Mon: []string{r}, Tue: []string{r}, Wed: []string{r}, Thu: []string{r}, Fri: []string{r}}
+	}
+
+	forex := models.OpeningHours{
+		Sun: []string{"22:00 - 00:00"},
+		Mon: allDay, Tue: allDay, Wed: allDay, Thu: allDay,
+		Fri:  []string{"00:00 - 21:59"},
+		Zone: "UTC",
+	}
+	always := models.OpeningHours{Mon: allDay, Tue: allDay, Wed: allDay, Thu: allDay, Fri: allDay, Sat: allDay, Sun: allDay}
+	overnight := models.OpeningHours{Mon: []string{"22:00 - 01:59"}}
+	merged := models.OpeningHours{Mon: allDay, Tue: []string{"00:00 - 11:59"}}
+	london := weekdays("08:00 - 16:29")
+	london.Zone = "Europe/London"
+	unknown := weekdays("08:00 - 16:59")
+	unknown.Zone = "Nowhere/Unknown"
+
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		hours     models.OpeningHours
+		offset    int
+		at        time.Time
+		open      bool
+		nextOpen  time.Time // zero when there is none
+		nextClose time.Time // zero when there is none
+	}{
+		{
+			name:      "forex midweek",
+			hours:     forex,
+			at:        utc(time.March, 6, 12, 0),
+			open:      true,
+			nextOpen:  utc(time.March, 10, 22, 0),
+			nextClose: utc(time.March, 8, 22, 0),
+		},
+		{
+			name:      "forex last minute of the week",
+			hours:     forex,
+			at:        utc(time.March, 8, 21, 59),
+			open:      true,
+			nextOpen:  utc(time.March, 10, 22, 0),
+			nextClose: utc(time.March, 8, 22, 0),
+		},
+		{
+			name:      "forex weekend",
+			hours:     forex,
+			at:        utc(time.March, 9, 12, 0),
+			nextOpen:  utc(time.March, 10, 22, 0),
+			nextClose: utc(time.March, 15, 22, 0),
+		},
+		{
+			name:      "forex reopening",
+			hours:     forex,
+			at:        utc(time.March, 10, 22, 0),
+			open:      true,
+			nextOpen:  utc(time.March, 17, 22, 0),
+			nextClose: utc(time.March, 15, 22, 0),
+		},
+		{
+			name:  "never closes",
+			hours: always,
+			at:    utc(time.March, 9, 12, 0),
+			open:  true,
+		},
+		{
+			name:  "no sessions",
+			hours: models.OpeningHours{},
+			at:    utc(time.March, 9, 12, 0),
+		},
+		{
+			name:      "past midnight",
+			hours:     overnight,
+			at:        utc(time.March, 5, 1, 0),
+			open:      true,
+			nextOpen:  utc(time.March, 11, 22, 0),
+			nextClose: utc(time.March, 5, 2, 0),
+		},
+		{
+			name:      "after a session past midnight",
+			hours:     overnight,
+			at:        utc(time.March, 5, 2, 0),
+			nextOpen:  utc(time.March, 11, 22, 0),
+			nextClose: utc(time.March, 12, 2, 0),
+		},
+		{
+			name:      "merged days",
+			hours:     merged,
+			at:        utc(time.March, 4, 10, 0),
+			open:      true,
+			nextOpen:  utc(time.March, 11, 0, 0),
+			nextClose: utc(time.March, 5, 12, 0),
+		},
+		{
+			name:      "summer time starts",
+			hours:     london,
+			at:        utc(time.March, 29, 12, 0),
+			open:      true,
+			nextOpen:  utc(time.April, 1, 7, 0),
+			nextClose: utc(time.March, 29, 16, 30),
+		},
+		{
+			name:      "summer time ends",
+			hours:     london,
+			at:        utc(time.October, 25, 15, 30),
+			nextOpen:  utc(time.October, 28, 8, 0),
+			nextClose: utc(time.October, 28, 16, 30),
+		},
+		{
+			name:      "unknown zone uses the offset",
+			hours:     unknown,
+			offset:    2,
+			at:        utc(time.March, 4, 5, 30),
+			nextOpen:  utc(time.March, 4, 6, 0),
+			nextClose: utc(time.March, 4, 15, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, err := NewTradingHours(&tt.hours, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if open := th.IsOpen(tt.at); open != tt.open {
+				t.Errorf("IsOpen = %v, want %v", open, tt.open)
+			}
+
+			nextOpen, ok := th.NextOpen(tt.at)
+			if ok != !tt.nextOpen.IsZero() || !nextOpen.Equal(tt.nextOpen) {
+				t.Errorf("NextOpen = %s, %v, want %s", nextOpen, ok, tt.nextOpen)
+			}
+
+			nextClose, ok := th.NextClose(tt.at)
+			if ok != !tt.nextClose.IsZero() || !nextClose.Equal(tt.nextClose) {
+				t.Errorf("NextClose = %s, %v, want %s", nextClose, ok, tt.nextClose)
+			}
+		})
+	}
+}
+
+func TestNewTradingHoursInvalidRange(t *testing.T) {
+	if _, err := NewTradingHours(&models.OpeningHours{Mon: []string{"08:00"}}, 0); err == nil {
+		t.Fatal("a range without an end was accepted")
+	}
+}
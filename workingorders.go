@@ -0,0 +1,234 @@
+package capital
+
+import (
+	"capital/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (c *client) CreateWorkingOrder(ctx context.Context, demo bool, accountId string, order models.WorkingOrderRequest, cst, securityToken string) (string, error) {
+	if err := validateWorkingOrder(order); err != nil {
+		return "", err
+	}
+
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return "", err
+	}
+
+	key := orderKeyID{accountId: accountId, key: order.ClientOrderKey}
+	if key.key != "" {
+		dealID, done, err := c.resumeOrderKey(ctx, demo, key, workingOrderFingerprint(order), cst, securityToken)
+		if err != nil || done {
+			return dealID, err
+		}
+	}
+
+	if order.TrailingStop {
+		if err := c.checkTrailingStops(ctx, demo, accountId, order.Epic, cst, securityToken); err != nil {
+			return "", err
+		}
+	}
+
+	if key.key != "" {
+		existing, err := c.existingDeals(ctx, demo, models.ActivityTypeWorkingOrder, cst, securityToken)
+		if err != nil {
+			return "", err
+		}
+		c.beginOrderKey(key, workingOrderFingerprint(order), existing)
+	}
+
+	data, _, err := c.request(ctx, "POST", demo, "/workingorders", order, cst, securityToken, "")
+	if err != nil {
+		c.failOrderKey(key, err)
+		return "", fmt.Errorf("error creating working order: %w", err)
+	}
+
+	var response models.CapitalDealReference
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", fmt.Errorf("error parsing working order response: %w", err)
+	}
+
+	c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealReference = response.DealReference })
+
+	// Verify that the working order was actually created
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
+	if err != nil {
+		return "", fmt.Errorf("error confirming deal: %w", err)
+	}
+
+	if err := checkAccepted(confirm); err != nil {
+		c.forgetOrderKey(key)
+		return "", fmt.Errorf("working order was not accepted: %w", err)
+	}
+
+	dealID := affectedDealID(confirm, models.AffectedDealOpened)
+	if dealID == "" {
+		return "", fmt.Errorf("no affected deals found")
+	}
+
+	c.updateOrderKey(key, func(e *orderKeyEntry) { e.dealID = dealID })
+
+	return dealID, nil
+}
+
+func (c *client) GetWorkingOrders(ctx context.Context, demo bool, accountId, cst, securityToken string) (*models.WorkingOrdersResponse, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := c.request(ctx, "GET", demo, "/workingorders", nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error getting working orders: %w", err)
+	}
+
+	var response models.WorkingOrdersResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing working orders response: %w", err)
+	}
+
+	return &response, nil
+}
+
+func (c *client) UpdateWorkingOrder(ctx context.Context, demo bool, accountId, dealID string, update models.UpdateWorkingOrderRequest, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	if countSet(update.StopLevel, update.StopDistance, update.StopAmount) > 1 {
+		return nil, errors.New("only one of stop level, distance or amount may be set")
+	}
+
+	if countSet(update.ProfitLevel, update.ProfitDistance, update.ProfitAmount) > 1 {
+		return nil, errors.New("only one of profit level, distance or amount may be set")
+	}
+
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := c.request(ctx, "PUT", demo, "/workingorders/"+dealID, update, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error updating working order: %w", err)
+	}
+
+	var response models.CapitalDealReference
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing update working order response: %w", err)
+	}
+
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
+	if err != nil {
+		return nil, fmt.Errorf("error confirming working order update: %w", err)
+	}
+
+	if err := checkAccepted(confirm); err != nil {
+		return nil, fmt.Errorf("working order update not accepted: %w", err)
+	}
+
+	return confirm, nil
+}
+
+func (c *client) DeleteWorkingOrder(ctx context.Context, demo bool, accountId, dealID string, cst, securityToken string) (*models.CapitalDealConfirmation, error) {
+	unlock, err := c.lockSession(ctx, cst)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cst, securityToken, err = c.ensureAccount(ctx, demo, accountId, cst, securityToken)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := c.request(ctx, "DELETE", demo, "/workingorders/"+dealID, nil, cst, securityToken, "")
+	if err != nil {
+		return nil, fmt.Errorf("error deleting working order: %w", err)
+	}
+
+	var response models.CapitalDealReference
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("error parsing delete working order response: %w", err)
+	}
+
+	confirm, err := c.confirmDeal(ctx, demo, response.DealReference, cst, securityToken)
+	if err != nil {
+		return nil, fmt.Errorf("error confirming working order deletion: %w", err)
+	}
+
+	if err := checkAccepted(confirm); err != nil {
+		return nil, fmt.Errorf("working order deletion not accepted: %w", err)
+	}
+
+	return confirm, nil
+}
+
+func validateWorkingOrder(order models.WorkingOrderRequest) error {
+	if order.Epic == "" {
+		return errors.New("working order epic is required")
+	}
+
+	if !order.Direction.Valid() {
+		return fmt.Errorf("invalid working order direction %q", order.Direction)
+	}
+
+	if order.Type != models.WorkingOrderTypeLimit && order.Type != models.WorkingOrderTypeStop {
+		return fmt.Errorf("invalid working order type %q", order.Type)
+	}
+
+	if order.Size <= 0 {
+		return errors.New("working order size must be positive")
+	}
+
+	if order.Level <= 0 {
+		return errors.New("working order level must be positive")
+	}
+
+	if !order.GoodTillDate.IsZero() && !order.GoodTillDate.After(time.Now()) {
+		return errors.New("working order good till date is in the past")
+	}
+
+	if countSet(order.StopLevel, order.StopDistance, order.StopAmount) > 1 {
+		return errors.New("only one of stop level, distance or amount may be set")
+	}
+
+	if countSet(order.ProfitLevel, order.ProfitDistance, order.ProfitAmount) > 1 {
+		return errors.New("only one of profit level, distance or amount may be set")
+	}
+
+	if order.TrailingStop && (order.StopDistance == nil || order.GuaranteedStop) {
+		return errors.New("a trailing stop requires a stop distance and no guaranteed stop")
+	}
+
+	return nil
+}
+
+func countSet(values ...*float64) int {
+	n := 0
+	for _, v := range values {
+		if v != nil {
+			n++
+		}
+	}
+
+	return n
+}